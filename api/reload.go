@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"ecommerce-go-api-gateway/api/v1/middleware"
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/discovery"
+	healthcheck "ecommerce-go-api-gateway/pkg/health"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/services"
+
+	"go.uber.org/zap"
+)
+
+// reloadableKeys are the config sections applied without a restart.
+var reloadableKeys = []string{"services.", "rate_limit.", "health.", "logger.level"}
+
+// watchConfig applies config file changes to the service clients, rate
+// limits, health probes and log level, and makes next the active config.
+// Anything else is logged as needing a restart.
+func watchConfig(active *atomic.Pointer[config.Config], sc *services.ServiceContainer, limiter *middleware.RateLimiter, checker *healthcheck.Checker) {
+	config.Watch(func(next *config.Config, changes []config.Change) {
+		var pending []string
+		for _, ch := range changes {
+			logger.Log.Info("Config setting changed",
+				zap.String("key", ch.Key),
+				zap.Any("old", ch.Old),
+				zap.Any("new", ch.New))
+			if !isReloadable(ch.Key) {
+				pending = append(pending, ch.Key)
+			}
+		}
+
+		if next.Logger.Level != "" {
+			if err := logger.SetLevel(next.Logger.Level); err != nil {
+				logger.Log.Error("Failed to apply log level", zap.Error(err))
+			}
+		}
+		if err := limiter.Update(next.EffectiveRateLimit()); err != nil {
+			logger.Log.Error("Failed to apply rate limits", zap.Error(err))
+		}
+		rebuilt := sc.Reload(next)
+		checker.SetTiming(next.Health.Interval, next.Health.Timeout)
+		checker.SetTargets(healthTargets(next, sc.Endpoints))
+		active.Store(next)
+
+		logger.Log.Info("Config reloaded", zap.Strings("rebuilt_services", rebuilt))
+		if len(pending) > 0 {
+			logger.Log.Warn("Some config changes need a restart to take effect", zap.Strings("keys", pending))
+		}
+	}, func(err error) {
+		logger.Log.Error("Config change rejected, keeping the current config", zap.Error(err))
+	})
+}
+
+// watchDiscovery applies the endpoints found by service discovery to the
+// service clients and health probes as they change.
+func watchDiscovery(active *atomic.Pointer[config.Config], provider discovery.Provider, sc *services.ServiceContainer, checker *healthcheck.Checker) {
+	cfg := active.Load()
+	discovery.Watch(context.Background(), provider, sc.ServiceNames(), cfg.Discovery.RefreshInterval,
+		func(service string, endpoints []config.EndpointConfig) {
+			if !sc.SetEndpoints(service, endpoints) {
+				return
+			}
+			var urls []string
+			for _, e := range sc.Endpoints(service) {
+				urls = append(urls, e.URL)
+			}
+			logger.Log.Info("Service endpoints changed", zap.String("service", service), zap.Strings("endpoints", urls))
+			checker.SetTargets(healthTargets(active.Load(), sc.Endpoints))
+		},
+		func(service string, err error) {
+			logger.Log.Warn("Service discovery failed, keeping the current endpoints",
+				zap.String("service", service), zap.Error(err))
+		})
+}
+
+func isReloadable(key string) bool {
+	for _, prefix := range reloadableKeys {
+		if strings.HasPrefix(key, prefix) || key == strings.TrimSuffix(prefix, ".") {
+			return true
+		}
+	}
+	return false
+}
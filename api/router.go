@@ -1,17 +1,34 @@
 package api
 
 import (
+	"context"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"ecommerce-go-api-gateway/api/v1/admin"
+	"ecommerce-go-api-gateway/api/v1/checkout"
+	"ecommerce-go-api-gateway/api/v1/health"
 	"ecommerce-go-api-gateway/api/v1/inventory"
 	"ecommerce-go-api-gateway/api/v1/middleware"
 	"ecommerce-go-api-gateway/api/v1/notification"
 	"ecommerce-go-api-gateway/api/v1/order"
 	"ecommerce-go-api-gateway/api/v1/payment"
 	"ecommerce-go-api-gateway/api/v1/product"
+	"ecommerce-go-api-gateway/api/v1/proxy"
 	"ecommerce-go-api-gateway/api/v1/user"
 	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/discovery"
+	healthcheck "ecommerce-go-api-gateway/pkg/health"
+	"ecommerce-go-api-gateway/pkg/idempotency"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/metrics"
+	"ecommerce-go-api-gateway/pkg/ratelimit"
+	"ecommerce-go-api-gateway/pkg/utils"
 	"ecommerce-go-api-gateway/services"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 func SetupRouter(cfg *config.Config) *gin.Engine {
@@ -19,37 +36,139 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	utils.SetProblemJSON(cfg.Server.ProblemJSON)
+	utils.RegisterJSONFieldNames()
+
 	r := gin.New()
+	// Without trusted proxies ClientIP is the peer address, so clients
+	// cannot pick their own rate limit key through X-Forwarded-For.
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Log.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
+	r.Use(middleware.Metrics())
+	r.Use(middleware.Tracing())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.AccessLog(cfg.Logger.AccessLog))
 	r.Use(gin.Recovery())
-	r.Use(gin.Logger())
 	r.Use(middleware.Cors())
+	r.Use(middleware.ForwardIdempotencyKey())
+	r.Use(middleware.Authenticate(cfg.Auth))
+
+	rateLimitStore, err := ratelimit.NewStore(cfg.RateLimit.Store)
+	if err != nil {
+		logger.Log.Fatal("Invalid rate limit configuration", zap.Error(err))
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, cfg.EffectiveRateLimit())
+	r.Use(rateLimiter.Handler())
+
+	discoveryProvider, err := discovery.NewProvider(cfg.Discovery)
+	if err != nil {
+		logger.Log.Fatal("Invalid discovery configuration", zap.Error(err))
+	}
 
 	// Initialize Service Container
-	serviceContainer := services.NewServiceContainer(cfg)
+	serviceContainer := services.NewServiceContainer(cfg, discoveryProvider)
 
 	// Initialize Handlers
 	userHandler := user.NewUserHandler(serviceContainer.User)
 	productHandler := product.NewProductHandler(serviceContainer.Product)
 	orderHandler := order.NewOrderHandler(serviceContainer.Order)
 	paymentHandler := payment.NewPaymentHandler(serviceContainer.Payment)
-	inventoryHandler := inventory.NewInventoryHandler(serviceContainer.Inventory)
+	inventoryHandler := inventory.NewInventoryHandler(serviceContainer.Inventory, serviceContainer.Product)
 	notificationHandler := notification.NewNotificationHandler(serviceContainer.Notification)
+	checkoutHandler := checkout.NewCheckoutHandler(serviceContainer.Checkout)
+	adminHandler := admin.NewAdminHandler(serviceContainer.Breakers, serviceContainer.Balancers)
+	proxyHandler := proxy.NewProxyHandler(serviceContainer.Proxy)
+
+	checker := healthcheck.NewChecker(healthTargets(cfg, serviceContainer.Endpoints), cfg.Health.Interval, cfg.Health.Timeout)
+	checker.Start(context.Background())
+	healthHandler := health.NewHealthHandler(checker)
+
+	// Finish or undo checkouts interrupted by the last shutdown
+	go func() {
+		if err := serviceContainer.Checkout.Recover(context.Background()); err != nil {
+			logger.Log.Error("Checkout recovery failed", zap.Error(err))
+		}
+	}()
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	health.RegisterRoutes(&r.RouterGroup, healthHandler)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	idempotencyStore, err := idempotency.NewStore(cfg.Idempotency)
+	if err != nil {
+		logger.Log.Fatal("Invalid idempotency configuration", zap.Error(err))
+	}
+
+	// Middleware applied to every non-public route
+	protected := []gin.HandlerFunc{
+		middleware.RequireAuth(),
+		middleware.Authorize(cfg.EffectiveRBAC()),
+		middleware.Idempotency(idempotencyStore, cfg.Idempotency.TTL, cfg.Idempotency.Lease),
+	}
 
 	// API V1 Group
 	v1 := r.Group("/api/v1")
 	{
-		user.RegisterRoutes(v1, userHandler)
-		product.RegisterRoutes(v1, productHandler)
-		order.RegisterRoutes(v1, orderHandler)
-		payment.RegisterRoutes(v1, paymentHandler)
-		inventory.RegisterRoutes(v1, inventoryHandler)
-		notification.RegisterRoutes(v1, notificationHandler)
+		user.RegisterRoutes(v1, userHandler, protected...)
+		product.RegisterRoutes(v1, productHandler, protected...)
+		order.RegisterRoutes(v1, orderHandler, protected...)
+		payment.RegisterRoutes(v1, paymentHandler, protected...)
+		inventory.RegisterRoutes(v1, inventoryHandler, protected...)
+		notification.RegisterRoutes(v1, notificationHandler, protected...)
+		checkout.RegisterRoutes(v1, checkoutHandler, protected...)
+		admin.RegisterRoutes(v1, adminHandler, protected...)
+	}
+
+	// Routes declared in config, forwarded without a dedicated handler
+	if err := proxy.RegisterRoutes(&r.RouterGroup, proxyHandler, cfg.Proxy.Routes, protected...); err != nil {
+		logger.Log.Fatal("Invalid proxy route", zap.Error(err))
 	}
 
+	// The config in effect, replaced on every reload
+	var active atomic.Pointer[config.Config]
+	active.Store(cfg)
+	watchConfig(&active, serviceContainer, rateLimiter, checker)
+	watchDiscovery(&active, discoveryProvider, serviceContainer, checker)
+
 	return r
 }
+
+// healthTargets lists the readiness probe of every configured service at
+// the endpoints it is called at. A service with several endpoints gets one
+// probe per endpoint, named service@host.
+func healthTargets(cfg *config.Config, endpointsOf func(service string) []config.EndpointConfig) []healthcheck.Target {
+	var targets []healthcheck.Target
+	for name := range cfg.Services.BaseURLs() {
+		check := cfg.Health.Services[name]
+		path := check.Path
+		if path == "" {
+			path = cfg.Health.DefaultPath
+		}
+
+		endpoints := endpointsOf(name)
+		for _, e := range endpoints {
+			target := healthcheck.Target{
+				Name:     name,
+				URL:      strings.TrimSuffix(e.URL, "/") + path,
+				Optional: check.Optional,
+			}
+			if len(endpoints) > 1 {
+				target.Name = name + "@" + endpointHost(e.URL)
+				target.Group = name
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func endpointHost(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return u.Host + strings.TrimSuffix(u.Path, "/")
+	}
+	return raw
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
+	"ecommerce-go-api-gateway/pkg/loadbalancer"
+	"ecommerce-go-api-gateway/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	// breakers and balancers return the current ones, which change on
+	// config reload.
+	breakers  func() []*circuitbreaker.Breaker
+	balancers func() []*loadbalancer.Balancer
+}
+
+func NewAdminHandler(breakers func() []*circuitbreaker.Breaker, balancers func() []*loadbalancer.Balancer) *AdminHandler {
+	return &AdminHandler{breakers: breakers, balancers: balancers}
+}
+
+func (h *AdminHandler) ListBreakers(c *gin.Context) {
+	breakers := h.breakers()
+	snapshots := make([]circuitbreaker.Snapshot, 0, len(breakers))
+	for _, b := range breakers {
+		snapshots = append(snapshots, b.Snapshot())
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "Circuit breakers", snapshots)
+}
+
+func (h *AdminHandler) ListBalancers(c *gin.Context) {
+	balancers := h.balancers()
+	snapshots := make([]loadbalancer.Snapshot, 0, len(balancers))
+	for _, b := range balancers {
+		snapshots = append(snapshots, b.Snapshot())
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "Load balancers", snapshots)
+}
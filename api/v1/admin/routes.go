@@ -0,0 +1,13 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(r *gin.RouterGroup, handler *AdminHandler, protected ...gin.HandlerFunc) {
+	routes := r.Group("/admin", protected...)
+	{
+		routes.GET("/breakers", handler.ListBreakers)
+		routes.GET("/balancers", handler.ListBalancers)
+	}
+}
@@ -0,0 +1,42 @@
+package checkout
+
+import (
+	"ecommerce-go-api-gateway/api/v1/middleware"
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/utils"
+	"ecommerce-go-api-gateway/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CheckoutHandler struct {
+	service services.CheckoutService
+}
+
+func NewCheckoutHandler(service services.CheckoutService) *CheckoutHandler {
+	return &CheckoutHandler{service: service}
+}
+
+func (h *CheckoutHandler) Checkout(c *gin.Context) {
+	var req models.CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendBindError(c, err)
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	result, err := h.service.Checkout(c.Request.Context(), userID, req)
+	var failed *services.CheckoutError
+	if errors.As(err, &failed) {
+		utils.SendServiceErrorWithData(c, "Checkout failed", err, failed.Result)
+		return
+	}
+	if err != nil {
+		utils.SendServiceError(c, "Checkout failed", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusCreated, "Checkout completed", result)
+}
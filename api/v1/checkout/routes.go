@@ -0,0 +1,12 @@
+package checkout
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(r *gin.RouterGroup, handler *CheckoutHandler, protected ...gin.HandlerFunc) {
+	routes := r.Group("/checkout", protected...)
+	{
+		routes.POST("", handler.Checkout)
+	}
+}
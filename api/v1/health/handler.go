@@ -0,0 +1,35 @@
+package health
+
+import (
+	"net/http"
+
+	"ecommerce-go-api-gateway/pkg/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Livez reports that the process is up. It never looks at upstreams, so a
+// backend outage does not get the gateway restarted.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports the last probe of every upstream, and 503 when a
+// non-optional one is down.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ready, services := h.checker.Ready()
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "unready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "services": services})
+}
@@ -0,0 +1,10 @@
+package health
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterRoutes(r *gin.RouterGroup, handler *HealthHandler) {
+	r.GET("/livez", handler.Livez)
+	r.GET("/readyz", handler.Readyz)
+}
@@ -10,23 +10,37 @@ import (
 )
 
 type InventoryHandler struct {
-	service services.InventoryService
+	service  services.InventoryService
+	products services.ProductService
 }
 
-func NewInventoryHandler(service services.InventoryService) *InventoryHandler {
-	return &InventoryHandler{service: service}
+// NewInventoryHandler needs the product service to check If-Match, which
+// refers to the product's ETag, before stock updates.
+func NewInventoryHandler(service services.InventoryService, products services.ProductService) *InventoryHandler {
+	return &InventoryHandler{service: service, products: products}
 }
 
 func (h *InventoryHandler) UpdateStock(c *gin.Context) {
 	var req models.UpdateInventoryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	err := h.service.UpdateStock(req)
+	if c.GetHeader("If-Match") != "" {
+		product, err := h.products.GetProduct(services.WithFreshRead(c.Request.Context()), req.ProductID)
+		if err != nil {
+			utils.SendServiceError(c, "Failed to update stock", err)
+			return
+		}
+		if !utils.CheckIfMatch(c, product) {
+			return
+		}
+	}
+
+	err := h.service.UpdateStock(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to update stock", err.Error())
+		utils.SendServiceError(c, "Failed to update stock", err)
 		return
 	}
 
@@ -4,8 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.RouterGroup, handler *InventoryHandler) {
-	routes := r.Group("/inventory")
+func RegisterRoutes(r *gin.RouterGroup, handler *InventoryHandler, protected ...gin.HandlerFunc) {
+	routes := r.Group("/inventory", protected...)
 	{
 		routes.PUT("/stock", handler.UpdateStock)
 	}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/services"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AccessLog writes one zap log line per request with its route, status,
+// latency, size, user and the upstream calls it made. It must run after
+// RequestID and before Recovery so panics are logged as 500s.
+func AccessLog(cfg config.AccessLogConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx, calls := services.TrackUpstreamCalls(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := c.Writer.Status()
+		if status < http.StatusInternalServerError && !sampled(accessLogRatio(cfg, route)) {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.String("request_id", GetRequestID(c)),
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+		}
+		if userID, ok := GetUserID(c); ok {
+			fields = append(fields, zap.Uint("user_id", userID))
+		}
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+		}
+		if list := calls.List(); len(list) > 0 {
+			fields = append(fields, zap.Array("upstream", upstreamCalls(list)))
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		logger.Log.Info("Request", fields...)
+	}
+}
+
+func accessLogRatio(cfg config.AccessLogConfig, route string) float64 {
+	for _, r := range cfg.Routes {
+		if ok, _ := path.Match(r.Path, route); ok {
+			return r.SampleRatio
+		}
+	}
+	return cfg.SampleRatio
+}
+
+func sampled(ratio float64) bool {
+	return ratio >= 1 || (ratio > 0 && rand.Float64() < ratio)
+}
+
+type upstreamCalls []services.UpstreamCall
+
+func (u upstreamCalls) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, call := range u {
+		enc.AppendObject(zapcore.ObjectMarshalerFunc(func(o zapcore.ObjectEncoder) error {
+			o.AddString("operation", call.Operation)
+			o.AddInt("status", call.Status)
+			o.AddDuration("duration", call.Duration)
+			if call.Retries > 0 {
+				o.AddInt("retries", call.Retries)
+			}
+			if call.Shared {
+				o.AddBool("shared", true)
+			}
+			return nil
+		}))
+	}
+	return nil
+}
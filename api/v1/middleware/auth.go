@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/utils"
+	"ecommerce-go-api-gateway/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// ContextUserIDKey holds the authenticated user's ID (uint) on the gin.Context.
+	ContextUserIDKey = "userID"
+	// ContextClaimsKey holds the verified *Claims on the gin.Context.
+	ContextClaimsKey = "claims"
+
+	// contextAuthErrorKey holds why a presented token was rejected.
+	contextAuthErrorKey = "authError"
+)
+
+// Claims are the JWT claims issued by the user service on login.
+type Claims struct {
+	UserID uint     `json:"user_id,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Authenticate verifies the bearer token when the request carries one and
+// puts the user ID and claims on the context. It never rejects a request by
+// itself so it can run globally; protected routes add RequireAuth.
+func Authenticate(cfg config.AuthConfig) gin.HandlerFunc {
+	keyFunc, method, err := newKeyFunc(cfg)
+	if err != nil {
+		logger.Log.Fatal("Invalid auth configuration", zap.Error(err))
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{method}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	parser := jwt.NewParser(opts...)
+
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		claims, userID, reason := verifyToken(parser, keyFunc, header)
+		if reason != "" {
+			c.Set(contextAuthErrorKey, reason)
+			c.Next()
+			return
+		}
+
+		c.Set(ContextUserIDKey, userID)
+		c.Set(ContextClaimsKey, claims)
+		c.Request = c.Request.WithContext(services.WithUserID(c.Request.Context(), userID))
+		c.Next()
+	}
+}
+
+// RequireAuth rejects requests that Authenticate could not identify. Routes
+// that should stay public are simply registered without it.
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetUserID(c); ok {
+			c.Next()
+			return
+		}
+		reason := c.GetString(contextAuthErrorKey)
+		if reason == "" {
+			reason = "missing bearer token"
+		}
+		abortUnauthorized(c, reason)
+	}
+}
+
+func verifyToken(parser *jwt.Parser, keyFunc jwt.Keyfunc, header string) (*Claims, uint, string) {
+	tokenStr, ok := bearerToken(header)
+	if !ok {
+		return nil, 0, "missing bearer token"
+	}
+
+	claims := &Claims{}
+	if _, err := parser.ParseWithClaims(tokenStr, claims, keyFunc); err != nil {
+		return nil, 0, "invalid token"
+	}
+
+	userID := claims.UserID
+	if userID == 0 && claims.Subject != "" {
+		id, err := strconv.ParseUint(claims.Subject, 10, 32)
+		if err != nil {
+			return nil, 0, "invalid token subject"
+		}
+		userID = uint(id)
+	}
+	if userID == 0 {
+		return nil, 0, "token has no user"
+	}
+	return claims, userID, ""
+}
+
+// GetUserID returns the authenticated user's ID set by Authenticate.
+func GetUserID(c *gin.Context) (uint, bool) {
+	v, ok := c.Get(ContextUserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(uint)
+	return id, ok
+}
+
+// GetClaims returns the verified token claims set by Authenticate.
+func GetClaims(c *gin.Context) (*Claims, bool) {
+	v, ok := c.Get(ContextClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*Claims)
+	return claims, ok
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func abortUnauthorized(c *gin.Context, reason string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	utils.SendError(c, http.StatusUnauthorized, "Unauthorized", reason)
+	c.Abort()
+}
+
+func newKeyFunc(cfg config.AuthConfig) (jwt.Keyfunc, string, error) {
+	switch strings.ToUpper(cfg.Algorithm) {
+	case "", "HS256":
+		secret, err := loadSecret(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		return func(*jwt.Token) (interface{}, error) { return secret, nil }, jwt.SigningMethodHS256.Alg(), nil
+	case "RS256":
+		key, err := loadRSAPublicKey(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		return func(*jwt.Token) (interface{}, error) { return key, nil }, jwt.SigningMethodRS256.Alg(), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported auth.algorithm %q", cfg.Algorithm)
+	}
+}
+
+func loadSecret(cfg config.AuthConfig) ([]byte, error) {
+	secret := cfg.Secret
+	if secret == "" {
+		if cfg.SecretPath == "" {
+			return nil, errors.New("auth.secret or auth.secret_path is required for HS256")
+		}
+		data, err := os.ReadFile(cfg.SecretPath)
+		if err != nil {
+			return nil, fmt.Errorf("read secret: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, errors.New("auth.secret_path is empty")
+		}
+	}
+	// Validate only sees the inline secret; one read from a file is checked here.
+	if gin.Mode() == gin.ReleaseMode && config.IsPlaceholderSecret(secret) {
+		return nil, errors.New("placeholder auth secret is not allowed in release mode")
+	}
+	return []byte(secret), nil
+}
+
+func loadRSAPublicKey(cfg config.AuthConfig) (*rsa.PublicKey, error) {
+	pem := []byte(cfg.PublicKey)
+	if len(pem) == 0 {
+		if cfg.PublicKeyPath == "" {
+			return nil, errors.New("auth.public_key or auth.public_key_path is required for RS256")
+		}
+		data, err := os.ReadFile(cfg.PublicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		pem = data
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(pem)
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func signHS256(t *testing.T, secret string, claims jwt.Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthenticate(t *testing.T) {
+	cfg := config.AuthConfig{Algorithm: "HS256", Secret: testSecret, Issuer: "users", Audience: "gateway"}
+	expires := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	valid := func() Claims {
+		return Claims{UserID: 7, RegisteredClaims: jwt.RegisteredClaims{Issuer: "users", Audience: jwt.ClaimStrings{"gateway"}, ExpiresAt: expires}}
+	}
+	with := func(change func(*Claims)) Claims {
+		c := valid()
+		change(&c)
+		return c
+	}
+	bearer := func(claims Claims) string { return "Bearer " + signHS256(t, testSecret, claims) }
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantUser   uint
+		wantReason string
+	}{
+		{name: "valid token", header: bearer(valid()), wantStatus: http.StatusOK, wantUser: 7},
+		{name: "user from subject", header: bearer(with(func(c *Claims) { c.UserID, c.Subject = 0, "9" })), wantStatus: http.StatusOK, wantUser: 9},
+		{name: "missing token", header: "", wantStatus: http.StatusUnauthorized, wantReason: "missing bearer token"},
+		{name: "other scheme", header: "Basic dXNlcjpwYXNz", wantStatus: http.StatusUnauthorized, wantReason: "missing bearer token"},
+		{name: "empty bearer", header: "Bearer ", wantStatus: http.StatusUnauthorized, wantReason: "missing bearer token"},
+		{name: "malformed token", header: "Bearer not.a.jwt", wantStatus: http.StatusUnauthorized, wantReason: "invalid token"},
+		{name: "bad signature", header: "Bearer " + signHS256(t, "another-secret-another-secret-xx", valid()), wantStatus: http.StatusUnauthorized, wantReason: "invalid token"},
+		{name: "missing exp", header: bearer(with(func(c *Claims) { c.ExpiresAt = nil })), wantStatus: http.StatusUnauthorized, wantReason: "invalid token"},
+		{name: "expired", header: bearer(with(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) })), wantStatus: http.StatusUnauthorized, wantReason: "invalid token"},
+		{name: "issuer mismatch", header: bearer(with(func(c *Claims) { c.Issuer = "someone-else" })), wantStatus: http.StatusUnauthorized, wantReason: "invalid token"},
+		{name: "audience mismatch", header: bearer(with(func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} })), wantStatus: http.StatusUnauthorized, wantReason: "invalid token"},
+		{name: "bad subject", header: bearer(with(func(c *Claims) { c.UserID, c.Subject = 0, "alice" })), wantStatus: http.StatusUnauthorized, wantReason: "invalid token subject"},
+		{name: "no user", header: bearer(with(func(c *Claims) { c.UserID = 0 })), wantStatus: http.StatusUnauthorized, wantReason: "token has no user"},
+		{
+			name:       "unsigned token",
+			header:     "Bearer " + unsignedToken(t, valid()),
+			wantStatus: http.StatusUnauthorized,
+			wantReason: "invalid token",
+		},
+	}
+
+	r := gin.New()
+	r.Use(Authenticate(cfg))
+	r.GET("/me", RequireAuth(), func(c *gin.Context) {
+		userID, _ := GetUserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				var body struct {
+					UserID uint `json:"user_id"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &body)
+				if body.UserID != tt.wantUser {
+					t.Errorf("user = %d, want %d", body.UserID, tt.wantUser)
+				}
+				return
+			}
+			var body utils.APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != tt.wantReason {
+				t.Errorf("body = %s, want error %q", w.Body, tt.wantReason)
+			}
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func unsignedToken(t *testing.T, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestNewKeyFuncSecret(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	secretFile := file("secret", testSecret+"\n")
+	placeholderFile := file("placeholder", "change-me\n")
+	emptyFile := file("empty", "\n")
+
+	tests := []struct {
+		name    string
+		mode    string
+		cfg     config.AuthConfig
+		wantErr bool
+	}{
+		{name: "inline secret", mode: gin.ReleaseMode, cfg: config.AuthConfig{Secret: testSecret}},
+		{name: "secret file", mode: gin.ReleaseMode, cfg: config.AuthConfig{SecretPath: secretFile}},
+		{name: "no secret", mode: gin.DebugMode, cfg: config.AuthConfig{}, wantErr: true},
+		{name: "missing file", mode: gin.DebugMode, cfg: config.AuthConfig{SecretPath: filepath.Join(dir, "nope")}, wantErr: true},
+		{name: "empty file", mode: gin.DebugMode, cfg: config.AuthConfig{SecretPath: emptyFile}, wantErr: true},
+		{name: "placeholder in debug", mode: gin.DebugMode, cfg: config.AuthConfig{Secret: "change-me"}},
+		{name: "placeholder in release", mode: gin.ReleaseMode, cfg: config.AuthConfig{Secret: "change-me"}, wantErr: true},
+		{name: "placeholder ignores case", mode: gin.ReleaseMode, cfg: config.AuthConfig{Secret: "Change-Me"}, wantErr: true},
+		{name: "placeholder file in release", mode: gin.ReleaseMode, cfg: config.AuthConfig{SecretPath: placeholderFile}, wantErr: true},
+		{name: "unknown algorithm", mode: gin.DebugMode, cfg: config.AuthConfig{Algorithm: "ES256", Secret: testSecret}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(tt.mode)
+			defer gin.SetMode(gin.TestMode)
+
+			keyFunc, method, err := newKeyFunc(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newKeyFunc() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := tt.cfg.Secret
+			if want == "" {
+				want = testSecret
+			}
+			if key, _ := keyFunc(nil); method != "HS256" || string(key.([]byte)) != want {
+				t.Errorf("newKeyFunc() = %s key %q, want HS256 key %q", method, key, want)
+			}
+		})
+	}
+}
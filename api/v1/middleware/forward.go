@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"ecommerce-go-api-gateway/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardIdempotencyKey copies the client's Idempotency-Key header into the
+// request context so service calls pass it upstream and may retry writes.
+func ForwardIdempotencyKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := c.GetHeader(services.IdempotencyKeyHeader); key != "" {
+			c.Request = c.Request.WithContext(services.WithIdempotencyKey(c.Request.Context(), key))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ecommerce-go-api-gateway/pkg/idempotency"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/requestid"
+	"ecommerce-go-api-gateway/pkg/utils"
+	"ecommerce-go-api-gateway/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// IdempotentReplayedHeader marks a response replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	defaultIdempotencyTTL   = 24 * time.Hour
+	defaultIdempotencyLease = 2 * time.Minute
+)
+
+// Idempotency honors the Idempotency-Key header on POST, PUT and PATCH. The
+// first response for a key (scoped to user, method and path) is stored and
+// replayed for repeats; a repeat with a different body gets 422 and one that
+// arrives while the first is still running gets 409. 5xx responses are not
+// stored so the client can retry. A key stays in progress for at most lease,
+// so a claim orphaned by a crash does not block retries until ttl runs out.
+// It must run after RequireAuth.
+func Idempotency(store idempotency.Store, ttl, lease time.Duration) gin.HandlerFunc {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	if lease <= 0 {
+		lease = defaultIdempotencyLease
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(services.IdempotencyKeyHeader)
+		if key == "" || !isIdempotentMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.SendError(c, http.StatusBadRequest, "Invalid Idempotency-Key", "key is too long")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.SendError(c, http.StatusBadRequest, "Invalid request", "could not read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		userID, _ := GetUserID(c)
+		storeKey := fmt.Sprintf("%d|%s %s|%s", userID, c.Request.Method, c.Request.URL.Path, key)
+
+		rec, claimed, err := store.Begin(storeKey, fingerprint, lease)
+		if err != nil {
+			// Fail open: losing deduplication beats rejecting the request
+			logger.Log.Error("Idempotency store unavailable", zap.Error(err))
+			c.Next()
+			return
+		}
+
+		if !claimed {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				utils.SendError(c, http.StatusUnprocessableEntity, "Idempotency-Key reused", "key was already used with a different request body")
+			case !rec.Completed:
+				utils.SendError(c, http.StatusConflict, "Request in progress", "a request with this Idempotency-Key is still being processed")
+			default:
+				replay(c, rec)
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		finished := false
+		defer func() {
+			// A panicking handler must not leave the key stuck in progress
+			if !finished {
+				releaseKey(store, storeKey)
+			}
+		}()
+
+		c.Next()
+		finished = true
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			releaseKey(store, storeKey)
+			return
+		}
+
+		err = store.Complete(storeKey, &idempotency.Record{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			StatusCode:  status,
+			Header:      recorder.Header().Clone(),
+			Body:        recorder.body.Bytes(),
+			ExpiresAt:   time.Now().Add(ttl),
+		})
+		if err != nil {
+			logger.Log.Error("Failed to store idempotent response", zap.Error(err))
+		}
+	}
+}
+
+func replay(c *gin.Context, rec *idempotency.Record) {
+	header := c.Writer.Header()
+	for k, v := range rec.Header {
+		if replayedHeader(k) {
+			header[k] = v
+		}
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	c.Writer.WriteHeader(rec.StatusCode)
+	c.Writer.Write(rec.Body)
+}
+
+// replayedHeader reports whether a stored header is sent again on replay.
+// The replay keeps this request's own ID and rate limit state, which the
+// earlier middleware already set.
+func replayedHeader(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	return key != http.CanonicalHeaderKey(requestid.Header) &&
+		key != "Retry-After" &&
+		!strings.HasPrefix(key, "Ratelimit-")
+}
+
+func releaseKey(store idempotency.Store, key string) {
+	if err := store.Release(key); err != nil {
+		logger.Log.Error("Failed to release idempotency key", zap.Error(err))
+	}
+}
+
+func isIdempotentMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// responseRecorder copies everything written to the client into body.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
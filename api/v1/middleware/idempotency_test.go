@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/pkg/idempotency"
+	"ecommerce-go-api-gateway/pkg/requestid"
+	"ecommerce-go-api-gateway/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyServer serves POST /orders behind Idempotency for user 7. The
+// handler answers with status, or panics if status is 0. Before the
+// middleware each request gets its own request ID and rate limit headers,
+// as RequestID and the rate limiter would set them.
+type idempotencyServer struct {
+	router  *gin.Engine
+	status  int
+	calls   int
+	during  func() // run inside the handler
+	counter int
+}
+
+func newIdempotencyServer(store idempotency.Store) *idempotencyServer {
+	s := &idempotencyServer{router: gin.New()}
+	s.router.Use(gin.RecoveryWithWriter(io.Discard), func(c *gin.Context) {
+		s.counter++
+		c.Header(requestid.Header, "req-"+strconv.Itoa(s.counter))
+		c.Header("RateLimit-Remaining", strconv.Itoa(10-s.counter))
+		if s.counter == 1 {
+			c.Header("Retry-After", "30")
+		}
+		c.Set(ContextUserIDKey, uint(7))
+	})
+	s.router.POST("/orders", Idempotency(store, time.Hour, time.Minute), func(c *gin.Context) {
+		s.calls++
+		if s.during != nil {
+			during := s.during
+			s.during = nil
+			during()
+		}
+		if s.status == 0 {
+			panic("handler failed")
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Header("Location", "/orders/"+strconv.Itoa(s.calls))
+		c.String(s.status, "order %d for %s", s.calls, body)
+	})
+	return s
+}
+
+func (s *idempotencyServer) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(services.IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	type request struct {
+		key          string
+		body         string
+		status       int // what the handler answers; 0 panics
+		wantStatus   int
+		wantBody     string
+		wantReplayed bool
+	}
+	tests := []struct {
+		name      string
+		requests  []request
+		wantCalls int
+	}{
+		{
+			name: "repeat is replayed",
+			requests: []request{
+				{key: "k", body: "a", status: 201, wantStatus: 201, wantBody: "order 1 for a"},
+				{key: "k", body: "a", status: 201, wantStatus: 201, wantBody: "order 1 for a", wantReplayed: true},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "client errors are replayed",
+			requests: []request{
+				{key: "k", body: "a", status: 400, wantStatus: 400, wantBody: "order 1 for a"},
+				{key: "k", body: "a", status: 201, wantStatus: 400, wantBody: "order 1 for a", wantReplayed: true},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "different body",
+			requests: []request{
+				{key: "k", body: "a", status: 201, wantStatus: 201},
+				{key: "k", body: "b", status: 201, wantStatus: 422},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "keys are independent",
+			requests: []request{
+				{key: "k1", body: "a", status: 201, wantStatus: 201, wantBody: "order 1 for a"},
+				{key: "k2", body: "a", status: 201, wantStatus: 201, wantBody: "order 2 for a"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "no key",
+			requests: []request{
+				{body: "a", status: 201, wantStatus: 201},
+				{body: "a", status: 201, wantStatus: 201},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "server error releases the key",
+			requests: []request{
+				{key: "k", body: "a", status: 503, wantStatus: 503},
+				{key: "k", body: "a", status: 201, wantStatus: 201, wantBody: "order 2 for a"},
+				{key: "k", body: "a", status: 201, wantStatus: 201, wantBody: "order 2 for a", wantReplayed: true},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "panic releases the key",
+			requests: []request{
+				{key: "k", body: "a", status: 0, wantStatus: 500},
+				{key: "k", body: "a", status: 201, wantStatus: 201, wantBody: "order 2 for a"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "key too long",
+			requests: []request{
+				{key: strings.Repeat("k", maxIdempotencyKeyLength+1), body: "a", status: 201, wantStatus: 400},
+			},
+			wantCalls: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newIdempotencyServer(idempotency.NewMemoryStore())
+			for i, r := range tt.requests {
+				s.status = r.status
+				w := s.post(r.key, r.body)
+				if w.Code != r.wantStatus {
+					t.Fatalf("request %d: status = %d, want %d: %s", i, w.Code, r.wantStatus, w.Body)
+				}
+				if r.wantBody != "" && w.Body.String() != r.wantBody {
+					t.Errorf("request %d: body = %q, want %q", i, w.Body, r.wantBody)
+				}
+				if replayed := w.Header().Get(IdempotentReplayedHeader) == "true"; replayed != r.wantReplayed {
+					t.Errorf("request %d: replayed = %v, want %v", i, replayed, r.wantReplayed)
+				}
+			}
+			if s.calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", s.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	s := newIdempotencyServer(idempotency.NewMemoryStore())
+	s.status = 201
+
+	var repeat *httptest.ResponseRecorder
+	s.during = func() { repeat = s.post("k", "a") }
+	if w := s.post("k", "a"); w.Code != 201 {
+		t.Fatalf("first request: status = %d, want 201", w.Code)
+	}
+	if repeat.Code != http.StatusConflict {
+		t.Errorf("repeat while in progress: status = %d, want 409: %s", repeat.Code, repeat.Body)
+	}
+	if w := s.post("k", "a"); w.Code != 201 || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("repeat after completion: status = %d replayed = %q, want a 201 replay", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+	if s.calls != 1 {
+		t.Errorf("handler called %d times, want 1", s.calls)
+	}
+}
+
+func TestIdempotencyReplayHeaders(t *testing.T) {
+	s := newIdempotencyServer(idempotency.NewMemoryStore())
+	s.status = 201
+	s.post("k", "a")
+	w := s.post("k", "a")
+
+	want := map[string]string{
+		"Location":            "/orders/1",
+		requestid.Header:      "req-2",
+		"RateLimit-Remaining": "8",
+		"Retry-After":         "",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("replayed %s = %q, want %q", k, got, v)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"ecommerce-go-api-gateway/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests that matched no route, so arbitrary paths
+// cannot blow up metric cardinality.
+const unmatchedRoute = "unmatched"
+
+// Metrics records request counts, latency and in-flight requests per route
+// template (e.g. /api/v1/orders/:id). It must run before Recovery so
+// recovered panics are counted as 500s.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		done := metrics.HTTPRequestStarted(c.Request.Method, route)
+		c.Next()
+		done(c.Writer.Status())
+	}
+}
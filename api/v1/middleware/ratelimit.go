@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/ratelimit"
+	"ecommerce-go-api-gateway/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader identifies API clients for api_key rate limits.
+const APIKeyHeader = "X-API-Key"
+
+// RateLimiter limits request rates per client using the rule that matches
+// the route, falling back to the default rule. Its rules can be replaced at
+// runtime with Update.
+type RateLimiter struct {
+	store ratelimit.Store
+	cfg   atomic.Pointer[config.RateLimitConfig]
+}
+
+func NewRateLimiter(store ratelimit.Store, cfg config.RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{store: store}
+	if err := l.Update(cfg); err != nil {
+		logger.Log.Fatal("Invalid rate limit configuration", zap.Error(err))
+	}
+	return l
+}
+
+// Update validates cfg and makes it the active configuration. Counters
+// already in the store are kept.
+func (l *RateLimiter) Update(cfg config.RateLimitConfig) error {
+	for _, rule := range append([]config.RateLimitRule{cfg.Default}, cfg.Routes...) {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Path, err)
+		}
+	}
+	l.cfg.Store(&cfg)
+	return nil
+}
+
+// Handler returns the middleware. It runs globally after Authenticate so
+// user keyed limits can see the caller; anonymous requests on those routes
+// are limited by IP. If the store fails the request is let through.
+func (l *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := l.cfg.Load()
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+
+		rule := matchRateLimitRule(*cfg, c.Request.Method, c.FullPath())
+		if rule.Limit <= 0 {
+			c.Next()
+			return
+		}
+
+		key := rule.Method + " " + rule.Path + "|" + rateLimitClient(c, rule.Key)
+		var res ratelimit.Result
+		var err error
+		if rule.Algorithm == config.RateLimitSlidingWindow {
+			res, err = l.store.SlidingWindow(key, rule.Limit, rule.Window)
+		} else {
+			res, err = l.store.TokenBucket(key, tokenBucketCapacity(rule), float64(rule.Limit)/rule.Window.Seconds())
+		}
+		if err != nil {
+			logger.Log.Error("Rate limit store unavailable", zap.Error(err))
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		header.Set("RateLimit-Policy", rateLimitPolicy(rule))
+
+		if !res.Allowed {
+			header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+			utils.SendError(c, http.StatusTooManyRequests, "Too many requests", "rate limit exceeded")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func matchRateLimitRule(cfg config.RateLimitConfig, method, route string) config.RateLimitRule {
+	for _, rule := range cfg.Routes {
+		if rule.Method != "" && rule.Method != "*" && !strings.EqualFold(rule.Method, method) {
+			continue
+		}
+		if ok, _ := path.Match(rule.Path, route); ok {
+			return rule
+		}
+	}
+	return cfg.Default
+}
+
+// rateLimitClient identifies the caller for the rule's key type. API keys
+// are hashed so they are never stored verbatim.
+func rateLimitClient(c *gin.Context, keyType string) string {
+	switch keyType {
+	case config.RateLimitKeyAPIKey:
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			sum := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(sum[:])
+		}
+	case config.RateLimitKeyUser:
+		if userID, ok := GetUserID(c); ok {
+			return fmt.Sprintf("user:%d", userID)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func tokenBucketCapacity(rule config.RateLimitRule) int {
+	if rule.Burst > 0 {
+		return rule.Burst
+	}
+	return rule.Limit
+}
+
+func rateLimitPolicy(rule config.RateLimitRule) string {
+	policy := fmt.Sprintf("%d;w=%d", rule.Limit, ceilSeconds(rule.Window))
+	if rule.Algorithm != config.RateLimitSlidingWindow {
+		policy += fmt.Sprintf(";burst=%d", tokenBucketCapacity(rule))
+	}
+	return policy
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
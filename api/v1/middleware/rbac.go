@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RoleCustomer = "customer"
+	RoleMerchant = "merchant"
+	RoleAdmin    = "admin"
+
+	// wildcardPermission grants every permission.
+	wildcardPermission = "*"
+)
+
+// Authorize returns a middleware that enforces the RBAC policy table. It must
+// run after RequireAuth. Routes without a matching policy only require
+// authentication.
+func Authorize(cfg config.RBACConfig) gin.HandlerFunc {
+	roles := make(map[string]map[string]bool, len(cfg.Roles))
+	for role, perms := range cfg.Roles {
+		set := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			set[p] = true
+		}
+		roles[strings.ToLower(role)] = set
+	}
+
+	return func(c *gin.Context) {
+		required := requiredPermissions(cfg.Policies, c.Request.Method, c.FullPath())
+		if len(required) == 0 {
+			c.Next()
+			return
+		}
+
+		claims, _ := GetClaims(c)
+		for _, perm := range required {
+			if !hasPermission(roles, claims, perm) {
+				utils.SendError(c, http.StatusForbidden, "Forbidden", "insufficient permissions")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// HasRole reports whether the authenticated caller carries the given role.
+func HasRole(c *gin.Context, role string) bool {
+	claims, ok := GetClaims(c)
+	if !ok {
+		return false
+	}
+	for _, r := range claims.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOwnerOrAdmin reports whether the authenticated caller is ownerID or an admin.
+func IsOwnerOrAdmin(c *gin.Context, ownerID uint) bool {
+	if HasRole(c, RoleAdmin) {
+		return true
+	}
+	userID, ok := GetUserID(c)
+	return ok && userID == ownerID
+}
+
+func requiredPermissions(policies []config.PolicyConfig, method, route string) []string {
+	for _, p := range policies {
+		if p.Method != "" && p.Method != "*" && !strings.EqualFold(p.Method, method) {
+			continue
+		}
+		if ok, _ := path.Match(p.Path, route); ok {
+			return p.Permissions
+		}
+	}
+	return nil
+}
+
+func hasPermission(roles map[string]map[string]bool, claims *Claims, perm string) bool {
+	if claims == nil {
+		return false
+	}
+	for _, role := range claims.Roles {
+		granted := roles[strings.ToLower(role)]
+		if granted[wildcardPermission] || granted[perm] {
+			return true
+		}
+	}
+	return false
+}
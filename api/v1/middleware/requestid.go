@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"ecommerce-go-api-gateway/pkg/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ContextRequestIDKey holds the request ID on the gin.Context.
+	ContextRequestIDKey = "requestID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID takes the client's X-Request-ID, or generates one when it is
+// missing or malformed, and puts it on the context, the response and every
+// upstream call made for the request.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set(ContextRequestIDKey, id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID set by RequestID.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(ContextRequestIDKey)
+}
+
+// validRequestID accepts short printable ASCII IDs so a client cannot inject
+// log lines or oversized headers through it.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -20,13 +20,13 @@ func NewNotificationHandler(service services.NotificationService) *NotificationH
 func (h *NotificationHandler) SendNotification(c *gin.Context) {
 	var req models.SendNotificationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	err := h.service.SendNotification(req)
+	err := h.service.SendNotification(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to send notification", err.Error())
+		utils.SendServiceError(c, "Failed to send notification", err)
 		return
 	}
 
@@ -4,8 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.RouterGroup, handler *NotificationHandler) {
-	routes := r.Group("/notifications")
+func RegisterRoutes(r *gin.RouterGroup, handler *NotificationHandler, protected ...gin.HandlerFunc) {
+	routes := r.Group("/notifications", protected...)
 	{
 		routes.POST("", handler.SendNotification)
 	}
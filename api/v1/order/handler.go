@@ -1,6 +1,7 @@
 package order
 
 import (
+	"ecommerce-go-api-gateway/api/v1/middleware"
 	"ecommerce-go-api-gateway/models"
 	"ecommerce-go-api-gateway/pkg/utils"
 	"ecommerce-go-api-gateway/services"
@@ -21,13 +22,13 @@ func NewOrderHandler(service services.OrderService) *OrderHandler {
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var req models.CreateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	order, err := h.service.CreateOrder(req)
+	order, err := h.service.CreateOrder(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to create order", err.Error())
+		utils.SendServiceError(c, "Failed to create order", err)
 		return
 	}
 
@@ -42,11 +43,64 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := h.service.GetOrder(uint(id))
+	order, err := h.service.GetOrder(c.Request.Context(), uint(id))
 	if err != nil {
-		utils.SendError(c, http.StatusNotFound, "Order not found", err.Error())
+		utils.SendServiceError(c, "Failed to get order", err)
 		return
 	}
 
-	utils.SendSuccess(c, http.StatusOK, "Order details", order)
+	// Respond as if the order does not exist so IDs cannot be probed
+	if !middleware.IsOwnerOrAdmin(c, order.UserID) {
+		utils.SendNotFound(c, "Failed to get order")
+		return
+	}
+
+	utils.SendConditional(c, "Order details", order)
+}
+
+// ListOrders returns the caller's own orders.
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		utils.SendError(c, http.StatusUnauthorized, "Unauthorized", "authentication required")
+		return
+	}
+
+	orders, err := h.service.ListOrders(c.Request.Context(), userID)
+	if err != nil {
+		utils.SendServiceError(c, "Failed to list orders", err)
+		return
+	}
+
+	utils.SendConditional(c, "Orders list", orders)
+}
+
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendError(c, http.StatusBadRequest, "Invalid order ID", err.Error())
+		return
+	}
+
+	order, err := h.service.GetOrder(services.WithFreshRead(c.Request.Context()), uint(id))
+	if err != nil {
+		utils.SendServiceError(c, "Failed to cancel order", err)
+		return
+	}
+	// Respond as if the order does not exist so IDs cannot be probed
+	if !middleware.IsOwnerOrAdmin(c, order.UserID) {
+		utils.SendNotFound(c, "Failed to cancel order")
+		return
+	}
+	if !utils.CheckIfMatch(c, order) {
+		return
+	}
+
+	order, err = h.service.CancelOrder(c.Request.Context(), uint(id))
+	if err != nil {
+		utils.SendServiceError(c, "Failed to cancel order", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "Order cancelled successfully", order)
 }
@@ -4,10 +4,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.RouterGroup, handler *OrderHandler) {
-	routes := r.Group("/orders")
+func RegisterRoutes(r *gin.RouterGroup, handler *OrderHandler, protected ...gin.HandlerFunc) {
+	routes := r.Group("/orders", protected...)
 	{
 		routes.POST("", handler.CreateOrder)
+		routes.GET("", handler.ListOrders)
 		routes.GET("/:id", handler.GetOrder)
+		routes.POST("/:id/cancel", handler.CancelOrder)
 	}
 }
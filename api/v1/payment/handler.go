@@ -20,13 +20,13 @@ func NewPaymentHandler(service services.PaymentService) *PaymentHandler {
 func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
 	var req models.CreatePaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	payment, err := h.service.ProcessPayment(req)
+	payment, err := h.service.ProcessPayment(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to process payment", err.Error())
+		utils.SendServiceError(c, "Failed to process payment", err)
 		return
 	}
 
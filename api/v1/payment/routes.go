@@ -4,8 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.RouterGroup, handler *PaymentHandler) {
-	routes := r.Group("/payments")
+func RegisterRoutes(r *gin.RouterGroup, handler *PaymentHandler, protected ...gin.HandlerFunc) {
+	routes := r.Group("/payments", protected...)
 	{
 		routes.POST("", handler.ProcessPayment)
 	}
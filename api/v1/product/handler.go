@@ -4,6 +4,7 @@ import (
 	"ecommerce-go-api-gateway/models"
 	"ecommerce-go-api-gateway/pkg/utils"
 	"ecommerce-go-api-gateway/services"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -19,44 +20,160 @@ func NewProductHandler(service services.ProductService) *ProductHandler {
 }
 
 func (h *ProductHandler) ListProducts(c *gin.Context) {
-	products, err := h.service.ListProducts()
+	var query models.ProductQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.SendBindError(c, err)
+		return
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		utils.SendError(c, http.StatusBadRequest, "Invalid request", "min_price must not be greater than max_price")
+		return
+	}
+	if query.PageSize == 0 {
+		query.PageSize = models.DefaultProductPageSize
+	}
+	if query.Page == 0 && query.Cursor == "" {
+		query.Page = 1
+	}
+
+	page, err := h.service.ListProducts(c.Request.Context(), query)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to list products", err.Error())
+		utils.SendServiceError(c, "Failed to list products", err)
 		return
 	}
 
-	utils.SendSuccess(c, http.StatusOK, "Products list", products)
+	utils.SendConditionalPage(c, "Products list", page.Products, page.Pagination)
 }
 
 func (h *ProductHandler) GetProduct(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid product ID", err.Error())
+	id, ok := productID(c)
+	if !ok {
 		return
 	}
 
-	product, err := h.service.GetProduct(uint(id))
+	product, err := h.service.GetProduct(c.Request.Context(), id)
 	if err != nil {
-		utils.SendError(c, http.StatusNotFound, "Product not found", err.Error())
+		utils.SendServiceError(c, "Failed to get product", err)
 		return
 	}
 
-	utils.SendSuccess(c, http.StatusOK, "Product details", product)
+	utils.SendConditional(c, "Product details", product)
 }
 
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	var req models.CreateProductRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	product, err := h.service.CreateProduct(req)
+	product, err := h.service.CreateProduct(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to create product", err.Error())
+		utils.SendServiceError(c, "Failed to create product", err)
 		return
 	}
 
 	utils.SendSuccess(c, http.StatusCreated, "Product created successfully", product)
 }
+
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendBindError(c, err)
+		return
+	}
+	if !h.checkIfMatch(c, id, "Failed to update product") {
+		return
+	}
+
+	product, err := h.service.UpdateProduct(c.Request.Context(), id, req)
+	if err != nil {
+		utils.SendServiceError(c, "Failed to update product", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "Product updated successfully", product)
+}
+
+// PatchProduct applies a JSON Merge Patch to the product as it is now and
+// stores the result.
+func (h *ProductHandler) PatchProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+
+	current, err := h.service.GetProduct(services.WithFreshRead(c.Request.Context()), id)
+	if err != nil {
+		utils.SendServiceError(c, "Failed to update product", err)
+		return
+	}
+	if !utils.CheckIfMatch(c, current) {
+		return
+	}
+	req := models.UpdateProductRequest{
+		Name:        current.Name,
+		Description: current.Description,
+		Price:       current.Price,
+		Stock:       current.Stock,
+	}
+	if !utils.BindMergePatch(c, &req) {
+		return
+	}
+
+	product, err := h.service.UpdateProduct(c.Request.Context(), id, req)
+	if err != nil {
+		utils.SendServiceError(c, "Failed to update product", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "Product updated successfully", product)
+}
+
+func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+	if !h.checkIfMatch(c, id, "Failed to delete product") {
+		return
+	}
+
+	if err := h.service.DeleteProduct(c.Request.Context(), id); err != nil {
+		utils.SendServiceError(c, "Failed to delete product", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "Product deleted successfully", nil)
+}
+
+// checkIfMatch enforces If-Match, when sent, against the product as it is
+// now. message describes the failure if the product cannot be read.
+func (h *ProductHandler) checkIfMatch(c *gin.Context, id uint, message string) bool {
+	if c.GetHeader("If-Match") == "" {
+		return true
+	}
+	current, err := h.service.GetProduct(services.WithFreshRead(c.Request.Context()), id)
+	if err != nil {
+		utils.SendServiceError(c, message, err)
+		return false
+	}
+	return utils.CheckIfMatch(c, current)
+}
+
+func productID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendError(c, http.StatusBadRequest, "Invalid product ID", err.Error())
+		return 0, false
+	}
+	return uint(id), true
+}
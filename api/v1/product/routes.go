@@ -4,11 +4,18 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.RouterGroup, handler *ProductHandler) {
+func RegisterRoutes(r *gin.RouterGroup, handler *ProductHandler, protected ...gin.HandlerFunc) {
 	routes := r.Group("/products")
 	{
 		routes.GET("", handler.ListProducts)
 		routes.GET("/:id", handler.GetProduct)
-		routes.POST("", handler.CreateProduct)
+	}
+
+	private := routes.Group("", protected...)
+	{
+		private.POST("", handler.CreateProduct)
+		private.PUT("/:id", handler.UpdateProduct)
+		private.PATCH("/:id", handler.PatchProduct)
+		private.DELETE("/:id", handler.DeleteProduct)
 	}
 }
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/utils"
+	"ecommerce-go-api-gateway/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hopHeaders apply to a single connection and are not forwarded either way.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type ProxyHandler struct {
+	service services.ProxyService
+}
+
+func NewProxyHandler(service services.ProxyService) *ProxyHandler {
+	return &ProxyHandler{service: service}
+}
+
+// Forward returns the handler for one declared route. The request is sent
+// upstream with its headers, query and body; the upstream's status,
+// headers and body are returned unchanged unless it failed with a 5xx.
+func (h *ProxyHandler) Forward(route config.ProxyRoute) gin.HandlerFunc {
+	method := strings.ToUpper(route.Method)
+	upstreamPath := route.UpstreamPath
+	if upstreamPath == "" {
+		upstreamPath = route.Path
+	}
+	operation := method + " " + upstreamPath
+
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.SendError(c, http.StatusBadRequest, "Invalid request", "could not read request body")
+			return
+		}
+
+		resp, err := h.service.Forward(c.Request.Context(), services.ProxyRequest{
+			Service:   route.Service,
+			Operation: operation,
+			Method:    method,
+			Path:      expandPath(upstreamPath, c.Params),
+			RawQuery:  c.Request.URL.RawQuery,
+			Header:    forwardHeaders(c),
+			Body:      body,
+			Timeout:   route.Timeout,
+		})
+		if err != nil {
+			utils.SendServiceError(c, "Failed to forward request", err)
+			return
+		}
+
+		header := c.Writer.Header()
+		for k, v := range resp.Header {
+			// Headers the gateway set itself, such as X-Request-ID, win
+			if header.Get(k) == "" {
+				header[k] = v
+			}
+		}
+		removeHopHeaders(header)
+		header.Del("Content-Length")
+		c.Status(resp.StatusCode)
+		c.Writer.Write(resp.Body)
+	}
+}
+
+// expandPath fills the :name and *name segments of template with the
+// matched route's parameters.
+func expandPath(template string, params gin.Params) string {
+	segments := strings.Split(template, "/")
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			segments[i] = url.PathEscape(params.ByName(seg[1:]))
+		case strings.HasPrefix(seg, "*"):
+			// Catch-all values keep their slashes
+			rest := strings.Split(strings.TrimPrefix(params.ByName(seg[1:]), "/"), "/")
+			for j, s := range rest {
+				rest[j] = url.PathEscape(s)
+			}
+			segments[i] = strings.Join(rest, "/")
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func forwardHeaders(c *gin.Context) http.Header {
+	header := c.Request.Header.Clone()
+	removeHopHeaders(header)
+	header.Del("Content-Length")
+	// The service layer sends the authenticated user's ID; a value sent by
+	// the client is never forwarded
+	header.Del(services.UserIDHeader)
+
+	forwardedFor := c.RemoteIP()
+	if prior := header.Get("X-Forwarded-For"); prior != "" {
+		forwardedFor = prior + ", " + forwardedFor
+	}
+	header.Set("X-Forwarded-For", forwardedFor)
+	return header
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"ecommerce-go-api-gateway/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes registers every declared route on r. Routes that are not
+// public get the protected middleware first. It fails when a route
+// collides with one already registered.
+func RegisterRoutes(r *gin.RouterGroup, handler *ProxyHandler, routes []config.ProxyRoute, protected ...gin.HandlerFunc) error {
+	for _, route := range routes {
+		var handlers []gin.HandlerFunc
+		if !route.Public {
+			handlers = append(handlers, protected...)
+		}
+		handlers = append(handlers, handler.Forward(route))
+
+		if err := handle(r, strings.ToUpper(route.Method), route.Path, handlers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle turns gin's panic on a conflicting route into an error.
+func handle(r *gin.RouterGroup, method, path string, handlers []gin.HandlerFunc) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("proxy route %s %s: %v", method, path, p)
+		}
+	}()
+	r.Handle(method, path, handlers...)
+	return nil
+}
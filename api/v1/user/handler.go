@@ -1,6 +1,7 @@
 package user
 
 import (
+	"ecommerce-go-api-gateway/api/v1/middleware"
 	"ecommerce-go-api-gateway/models"
 	"ecommerce-go-api-gateway/pkg/utils"
 	"ecommerce-go-api-gateway/services"
@@ -21,13 +22,13 @@ func NewUserHandler(service services.UserService) *UserHandler {
 func (h *UserHandler) Register(c *gin.Context) {
 	var req models.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	user, err := h.service.Register(req)
+	user, err := h.service.Register(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusInternalServerError, "Failed to register user", err.Error())
+		utils.SendServiceError(c, "Failed to register user", err)
 		return
 	}
 
@@ -37,13 +38,13 @@ func (h *UserHandler) Register(c *gin.Context) {
 func (h *UserHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		utils.SendBindError(c, err)
 		return
 	}
 
-	resp, err := h.service.Login(req)
+	resp, err := h.service.Login(c.Request.Context(), req)
 	if err != nil {
-		utils.SendError(c, http.StatusUnauthorized, "Login failed", err.Error())
+		utils.SendServiceError(c, "Login failed", err)
 		return
 	}
 
@@ -51,18 +52,119 @@ func (h *UserHandler) Login(c *gin.Context) {
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	id, ok := h.ownUserID(c, "Failed to get user")
+	if !ok {
+		return
+	}
+
+	user, err := h.service.GetUser(c.Request.Context(), id)
 	if err != nil {
-		utils.SendError(c, http.StatusBadRequest, "Invalid user ID", err.Error())
+		utils.SendServiceError(c, "Failed to get user", err)
+		return
+	}
+
+	utils.SendConditional(c, "User details", user)
+}
+
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id, ok := h.ownUserID(c, "Failed to update user")
+	if !ok {
+		return
+	}
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendBindError(c, err)
+		return
+	}
+	if !h.checkIfMatch(c, id, "Failed to update user") {
 		return
 	}
 
-	user, err := h.service.GetUser(uint(id))
+	user, err := h.service.UpdateUser(c.Request.Context(), id, req)
 	if err != nil {
-		utils.SendError(c, http.StatusNotFound, "User not found", err.Error())
+		utils.SendServiceError(c, "Failed to update user", err)
 		return
 	}
 
-	utils.SendSuccess(c, http.StatusOK, "User details", user)
+	utils.SendSuccess(c, http.StatusOK, "User updated successfully", user)
+}
+
+// PatchUser applies a JSON Merge Patch to the user's profile as it is now
+// and stores the result.
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	id, ok := h.ownUserID(c, "Failed to update user")
+	if !ok {
+		return
+	}
+
+	current, err := h.service.GetUser(services.WithFreshRead(c.Request.Context()), id)
+	if err != nil {
+		utils.SendServiceError(c, "Failed to update user", err)
+		return
+	}
+	if !utils.CheckIfMatch(c, current) {
+		return
+	}
+	req := models.UpdateUserRequest{
+		Email:     current.Email,
+		FirstName: current.FirstName,
+		LastName:  current.LastName,
+	}
+	if !utils.BindMergePatch(c, &req) {
+		return
+	}
+
+	user, err := h.service.UpdateUser(c.Request.Context(), id, req)
+	if err != nil {
+		utils.SendServiceError(c, "Failed to update user", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "User updated successfully", user)
+}
+
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, ok := h.ownUserID(c, "Failed to delete user")
+	if !ok {
+		return
+	}
+	if !h.checkIfMatch(c, id, "Failed to delete user") {
+		return
+	}
+
+	if err := h.service.DeleteUser(c.Request.Context(), id); err != nil {
+		utils.SendServiceError(c, "Failed to delete user", err)
+		return
+	}
+
+	utils.SendSuccess(c, http.StatusOK, "User deleted successfully", nil)
+}
+
+// ownUserID parses the user ID of the path. Callers other than that user
+// or an admin get a 404, as if the user did not exist, so IDs cannot be
+// probed.
+func (h *UserHandler) ownUserID(c *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendError(c, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return 0, false
+	}
+	if !middleware.IsOwnerOrAdmin(c, uint(id)) {
+		utils.SendNotFound(c, message)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// checkIfMatch enforces If-Match, when sent, against the user as it is now.
+func (h *UserHandler) checkIfMatch(c *gin.Context, id uint, message string) bool {
+	if c.GetHeader("If-Match") == "" {
+		return true
+	}
+	current, err := h.service.GetUser(services.WithFreshRead(c.Request.Context()), id)
+	if err != nil {
+		utils.SendServiceError(c, message, err)
+		return false
+	}
+	return utils.CheckIfMatch(c, current)
 }
@@ -4,11 +4,18 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.RouterGroup, handler *UserHandler) {
+func RegisterRoutes(r *gin.RouterGroup, handler *UserHandler, protected ...gin.HandlerFunc) {
 	routes := r.Group("/users")
 	{
 		routes.POST("/register", handler.Register)
 		routes.POST("/login", handler.Login)
-		routes.GET("/:id", handler.GetUser)
+	}
+
+	private := routes.Group("", protected...)
+	{
+		private.GET("/:id", handler.GetUser)
+		private.PUT("/:id", handler.UpdateUser)
+		private.PATCH("/:id", handler.PatchUser)
+		private.DELETE("/:id", handler.DeleteUser)
 	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,11 +12,16 @@ import (
 	"ecommerce-go-api-gateway/api"
 	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/tracing"
 
 	"go.uber.org/zap"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(validateConfig(os.Args[2:]))
+	}
+
 	// 1. Load Config
 	cfg := config.LoadConfig()
 
@@ -24,13 +30,24 @@ func main() {
 	defer logger.Log.Sync()
 	logger.Log.Info("Starting API Gateway...")
 
+	shutdownTracing, err := tracing.Init(cfg.Tracing)
+	if err != nil {
+		logger.Log.Fatal("Invalid tracing configuration", zap.Error(err))
+	}
+
 	// 3. Setup Router
 	r := api.SetupRouter(cfg)
 
 	// 4. Start Server
+	// Every request context derives from baseCtx, so canceling it aborts
+	// in-flight upstream calls once the shutdown grace period is over.
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
 	srv := &http.Server{
-		Addr:    cfg.Server.Port,
-		Handler: r,
+		Addr:        cfg.Server.Port,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
 
 	go func() {
@@ -47,11 +64,21 @@ func main() {
 	<-quit
 	logger.Log.Info("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownTimeout := cfg.Server.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
+		cancelBase()
 		logger.Log.Fatal("Server forced to shutdown:", zap.Error(err))
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Log.Error("Failed to flush traces", zap.Error(err))
+	}
+
 	logger.Log.Info("Server exiting")
 }
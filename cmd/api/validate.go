@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"ecommerce-go-api-gateway/config"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// validateConfig implements "api validate-config [-config path] [-print]":
+// it loads and validates the config like startup does, and optionally
+// prints the effective settings with secrets masked. It returns the exit
+// code.
+func validateConfig(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	path := fs.String("config", "", "config file (default ./config/config.yaml)")
+	printSettings := fs.Bool("print", false, "print the effective config with secrets masked")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := config.Load(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return 1
+	}
+
+	if *printSettings {
+		out, err := yaml.Marshal(config.EffectiveSettings())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(out)
+	}
+	fmt.Fprintln(os.Stderr, "Configuration is valid")
+	return 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestValidateConfig(t *testing.T) {
+	shipped := filepath.Join("..", "..", "config", "config.yaml")
+	unknownKey := filepath.Join(t.TempDir(), "config.yaml")
+	data, err := os.ReadFile(shipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(unknownKey, append(data, "\nunknown_section: true\n"...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		secret     string
+		wantCode   int
+		wantStdout []string
+	}{
+		{name: "valid", args: []string{"-config", shipped}, secret: testSecret, wantCode: 0},
+		{name: "missing secret", args: []string{"-config", shipped}, wantCode: 1},
+		{name: "unknown key", args: []string{"-config", unknownKey}, secret: testSecret, wantCode: 1},
+		{name: "missing file", args: []string{"-config", filepath.Join(t.TempDir(), "nope.yaml")}, secret: testSecret, wantCode: 1},
+		{name: "bad flag", args: []string{"-verbose"}, wantCode: 2},
+		{
+			name:       "print masks secrets",
+			args:       []string{"-config", shipped, "-print"},
+			secret:     testSecret,
+			wantCode:   0,
+			wantStdout: []string{"secret: '[redacted]'", "port: :8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			t.Setenv("AUTH_SECRET", tt.secret)
+
+			var code int
+			stdout := captureOutput(t, func() { code = validateConfig(tt.args) })
+			if code != tt.wantCode {
+				t.Errorf("validateConfig() = %d, want %d", code, tt.wantCode)
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("output does not contain %q:\n%s", want, stdout)
+				}
+			}
+			if strings.Contains(stdout, testSecret) {
+				t.Errorf("output contains the secret:\n%s", stdout)
+			}
+		})
+	}
+}
+
+// captureOutput runs fn with stdout redirected and returns what it wrote.
+// Stderr is discarded.
+func captureOutput(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, devNull
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	fn()
+	os.Stdout, os.Stderr = stdout, stderr
+	w.Close()
+	return <-out
+}
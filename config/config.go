@@ -1,23 +1,52 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Services ServicesConfig `mapstructure:"services"`
-	Logger   LoggerConfig   `mapstructure:"logger"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Services    ServicesConfig    `mapstructure:"services"`
+	Logger      LoggerConfig      `mapstructure:"logger"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	RBAC        RBACConfig        `mapstructure:"rbac"`
+	Checkout    CheckoutConfig    `mapstructure:"checkout"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Health      HealthConfig      `mapstructure:"health"`
+	Proxy       ProxyConfig       `mapstructure:"proxy"`
+	Discovery   DiscoveryConfig   `mapstructure:"discovery"`
+	Cache       CacheConfig       `mapstructure:"cache"`
 }
 
 type ServerConfig struct {
 	Port string `mapstructure:"port"`
 	Mode string `mapstructure:"mode"`
+	// ShutdownTimeout is how long in-flight requests may drain on shutdown
+	// before their upstream calls are canceled.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// ProblemJSON sends every error as application/problem+json (RFC 7807).
+	// Otherwise clients opt in per request with Accept: application/problem+json.
+	ProblemJSON bool `mapstructure:"problem_json"`
+	// TrustedProxies lists the IPs or CIDRs of proxies whose
+	// X-Forwarded-For header is believed when resolving the client IP used
+	// for IP-keyed rate limits. Empty trusts none, so the peer address is used.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
+// ServicesConfig holds the base URL of every upstream service. A URL may
+// list several comma separated endpoints, which are load balanced with equal
+// weights; Balancers gives full control instead.
 type ServicesConfig struct {
 	UserService         string `mapstructure:"user_service"`
 	ProductService      string `mapstructure:"product_service"`
@@ -25,28 +54,479 @@ type ServicesConfig struct {
 	PaymentService      string `mapstructure:"payment_service"`
 	InventoryService    string `mapstructure:"inventory_service"`
 	NotificationService string `mapstructure:"notification_service"`
+
+	// Clients holds per-service client settings keyed by service name
+	// (e.g. order_service). Entries under "default" apply to every service.
+	Clients map[string]ClientConfig `mapstructure:"clients"`
+
+	// Balancers holds the endpoints and load balancing settings of services
+	// run as several instances, keyed by service name. Endpoints listed here
+	// replace the service's URL. The strategy and outlier settings under
+	// "default" apply to every service that does not set its own.
+	Balancers map[string]BalancerConfig `mapstructure:"balancers"`
+}
+
+type ClientConfig struct {
+	// Timeout bounds each upstream call, on top of the incoming request's context.
+	Timeout        time.Duration `mapstructure:"timeout"`
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	// ReadTimeout is how long to wait for response headers once the request is sent.
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+
+	// MaxRetries is the number of retries after the first attempt. Retries
+	// use capped exponential backoff with jitter between BackoffBase and
+	// BackoffCap, and only happen for RetryMethods or requests that carry an
+	// Idempotency-Key. Disabled turns retries off.
+	MaxRetries       int           `mapstructure:"max_retries"`
+	BackoffBase      time.Duration `mapstructure:"backoff_base"`
+	BackoffCap       time.Duration `mapstructure:"backoff_cap"`
+	RetryStatusCodes []int         `mapstructure:"retry_status_codes"`
+	RetryMethods     []string      `mapstructure:"retry_methods"`
+
+	Breaker BreakerConfig `mapstructure:"breaker"`
+}
+
+// BreakerConfig configures the per-service circuit breaker. A WindowSize of
+// Disabled (or zero in the default entry) turns it off. Rates are
+// percentages over the last WindowSize calls.
+type BreakerConfig struct {
+	WindowSize            int           `mapstructure:"window_size"`
+	MinimumCalls          int           `mapstructure:"minimum_calls"`
+	FailureRateThreshold  float64       `mapstructure:"failure_rate_threshold"`
+	SlowCallThreshold     time.Duration `mapstructure:"slow_call_threshold"`
+	SlowCallRateThreshold float64       `mapstructure:"slow_call_rate_threshold"`
+	OpenDuration          time.Duration `mapstructure:"open_duration"`
+	HalfOpenCalls         int           `mapstructure:"half_open_calls"`
+}
+
+// BalancerConfig spreads a service's calls over its endpoints. Strategy is
+// "round_robin" (weighted), "least_outstanding" (fewest requests awaiting a
+// response relative to weight) or "consistent_hash" (by the authenticated
+// user ID, so a user sticks to one endpoint; anonymous calls use round
+// robin).
+type BalancerConfig struct {
+	Strategy  string           `mapstructure:"strategy"`
+	Endpoints []EndpointConfig `mapstructure:"endpoints"`
+	Outlier   OutlierConfig    `mapstructure:"outlier"`
+}
+
+// EndpointConfig is one instance of a service. Weight defaults to 1.
+type EndpointConfig struct {
+	URL    string `mapstructure:"url"`
+	Weight int    `mapstructure:"weight"`
+}
+
+// OutlierConfig ejects an endpoint from load balancing for EjectionTime
+// (30s by default) after ConsecutiveFailures transport errors or 5xx
+// responses in a row. No more than MaxEjectionPercent (50 by default) of a
+// service's endpoints are ejected at once, but always at least one. A zero
+// ConsecutiveFailures disables ejection.
+type OutlierConfig struct {
+	ConsecutiveFailures int           `mapstructure:"consecutive_failures"`
+	EjectionTime        time.Duration `mapstructure:"ejection_time"`
+	MaxEjectionPercent  float64       `mapstructure:"max_ejection_percent"`
+}
+
+// Endpoints returns the instances of a service: those listed under
+// Balancers, or else every comma separated URL of the service.
+func (s ServicesConfig) Endpoints(name string) []EndpointConfig {
+	if b, ok := s.Balancers[name]; ok && len(b.Endpoints) > 0 {
+		return b.Endpoints
+	}
+	var endpoints []EndpointConfig
+	for _, u := range strings.Split(s.BaseURLs()[name], ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			endpoints = append(endpoints, EndpointConfig{URL: u, Weight: 1})
+		}
+	}
+	return endpoints
+}
+
+// Balancer returns the effective load balancing settings for a service,
+// falling back to the "default" entry for the strategy and, as a whole, the
+// outlier block.
+func (s ServicesConfig) Balancer(name string) BalancerConfig {
+	def := s.Balancers[DefaultClient]
+	cfg := s.Balancers[name]
+	if cfg.Strategy == "" {
+		cfg.Strategy = def.Strategy
+	}
+	if cfg.Outlier == (OutlierConfig{}) {
+		cfg.Outlier = def.Outlier
+	}
+	cfg.Endpoints = s.Endpoints(name)
+	return cfg
+}
+
+// BaseURLs returns the upstream base URLs keyed by service name.
+func (s ServicesConfig) BaseURLs() map[string]string {
+	return map[string]string{
+		"user_service":         s.UserService,
+		"product_service":      s.ProductService,
+		"order_service":        s.OrderService,
+		"payment_service":      s.PaymentService,
+		"inventory_service":    s.InventoryService,
+		"notification_service": s.NotificationService,
+	}
+}
+
+// DefaultClient is the Clients key whose settings apply to every service.
+const DefaultClient = "default"
+
+// Disabled is the max_retries or breaker.window_size that turns retries or
+// the breaker off. Zero cannot, since a zero override inherits the default.
+const Disabled = -1
+
+// Client returns the effective client settings for a service, falling back
+// to the "default" entry for anything the service does not override (zero
+// values and unset lists inherit the default; see Disabled to opt out).
+func (s ServicesConfig) Client(name string) ClientConfig {
+	cfg := s.Clients[DefaultClient]
+	override, ok := s.Clients[name]
+	if !ok {
+		return cfg
+	}
+	if override.Timeout > 0 {
+		cfg.Timeout = override.Timeout
+	}
+	if override.ConnectTimeout > 0 {
+		cfg.ConnectTimeout = override.ConnectTimeout
+	}
+	if override.ReadTimeout > 0 {
+		cfg.ReadTimeout = override.ReadTimeout
+	}
+	if override.MaxRetries != 0 {
+		cfg.MaxRetries = override.MaxRetries
+	}
+	if override.BackoffBase > 0 {
+		cfg.BackoffBase = override.BackoffBase
+	}
+	if override.BackoffCap > 0 {
+		cfg.BackoffCap = override.BackoffCap
+	}
+	if override.RetryStatusCodes != nil {
+		cfg.RetryStatusCodes = override.RetryStatusCodes
+	}
+	if override.RetryMethods != nil {
+		cfg.RetryMethods = override.RetryMethods
+	}
+	// A service's breaker block replaces the default one as a whole
+	if override.Breaker.WindowSize != 0 {
+		cfg.Breaker = override.Breaker
+	}
+	return cfg
 }
 
 type LoggerConfig struct {
-	Level string `mapstructure:"level"`
+	Level     string          `mapstructure:"level"`
+	AccessLog AccessLogConfig `mapstructure:"access_log"`
+}
+
+// AccessLogConfig controls the per-request access log. SampleRatio is the
+// share of requests logged (0 to 1); Routes override it for matching route
+// templates, which may use path.Match wildcards. Responses with a 5xx status
+// are always logged.
+type AccessLogConfig struct {
+	Enabled     bool             `mapstructure:"enabled"`
+	SampleRatio float64          `mapstructure:"sample_ratio"`
+	Routes      []AccessLogRoute `mapstructure:"routes"`
+}
+
+type AccessLogRoute struct {
+	Path        string  `mapstructure:"path"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// AuthConfig controls how bearer tokens issued by the user service are verified.
+// HS256 tokens are checked against Secret, RS256 tokens against the PEM encoded
+// PublicKey (or the file at PublicKeyPath).
+type AuthConfig struct {
+	Algorithm string `mapstructure:"algorithm"`
+	// Secret is the HS256 shared secret. It is not committed to the config
+	// file; set AUTH_SECRET or point SecretPath at a mounted secret file.
+	Secret        string `mapstructure:"secret"`
+	SecretPath    string `mapstructure:"secret_path"`
+	PublicKey     string `mapstructure:"public_key"`
+	PublicKeyPath string `mapstructure:"public_key_path"`
+	Issuer        string `mapstructure:"issuer"`
+	Audience      string `mapstructure:"audience"`
+}
+
+// RBACConfig maps roles carried in token claims to permissions, and routes to
+// the permissions they require. Policy paths are route templates as registered
+// with gin (e.g. /api/v1/orders/:id) and may use path.Match wildcards.
+type RBACConfig struct {
+	Roles    map[string][]string `mapstructure:"roles"`
+	Policies []PolicyConfig      `mapstructure:"policies"`
 }
 
+type PolicyConfig struct {
+	Method      string   `mapstructure:"method"`
+	Path        string   `mapstructure:"path"`
+	Permissions []string `mapstructure:"permissions"`
+}
+
+// CheckoutConfig configures the checkout saga. StateDir holds one JSON file
+// per checkout so incomplete sagas can be recovered after a restart; Timeout
+// bounds a whole checkout including compensation.
+type CheckoutConfig struct {
+	StateDir string        `mapstructure:"state_dir"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// IdempotencyConfig configures Idempotency-Key handling on POST/PUT/PATCH
+// routes. Store is "memory" or "file" (records kept under Dir); TTL is how
+// long a key is remembered.
+type IdempotencyConfig struct {
+	Store string        `mapstructure:"store"`
+	Dir   string        `mapstructure:"dir"`
+	TTL   time.Duration `mapstructure:"ttl"`
+	// Lease bounds how long a request may hold its key in progress. A claim
+	// left behind by a crash is taken over once it expires, so the lease
+	// must outlast the slowest protected request (checkout included).
+	Lease time.Duration `mapstructure:"lease"`
+}
+
+// RateLimitConfig configures request rate limiting. The first route rule
+// whose method and path match the request applies, otherwise Default does.
+// Route paths are gin route templates and may use path.Match wildcards.
+type RateLimitConfig struct {
+	Enabled bool            `mapstructure:"enabled"`
+	Store   string          `mapstructure:"store"`
+	Default RateLimitRule   `mapstructure:"default"`
+	Routes  []RateLimitRule `mapstructure:"routes"`
+}
+
+// RateLimitRule allows Limit requests per Window for each client, identified
+// by Key ("ip", "api_key" or "user"). Algorithm is "token_bucket" (bursts of
+// up to Burst, refilled at Limit/Window) or "sliding_window". A zero Limit
+// disables limiting for the matched routes.
+type RateLimitRule struct {
+	Method    string        `mapstructure:"method"`
+	Path      string        `mapstructure:"path"`
+	Algorithm string        `mapstructure:"algorithm"`
+	Key       string        `mapstructure:"key"`
+	Limit     int           `mapstructure:"limit"`
+	Window    time.Duration `mapstructure:"window"`
+	Burst     int           `mapstructure:"burst"`
+}
+
+// TracingConfig configures OpenTelemetry tracing. Exporter is "otlp" (OTLP
+// over HTTP to Endpoint), "stdout", or "file" (JSON spans appended to File).
+// SampleRatio is the share of new traces recorded; requests that arrive with
+// a sampled traceparent are always recorded.
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	ServiceName string  `mapstructure:"service_name"`
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	File        string  `mapstructure:"file"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// HealthConfig configures the background readiness probes. Every service is
+// probed at its base URL plus Path (DefaultPath unless overridden in
+// Services); a failing service makes the gateway unready unless it is
+// marked optional.
+type HealthConfig struct {
+	Interval    time.Duration                `mapstructure:"interval"`
+	Timeout     time.Duration                `mapstructure:"timeout"`
+	DefaultPath string                       `mapstructure:"default_path"`
+	Services    map[string]HealthCheckConfig `mapstructure:"services"`
+}
+
+type HealthCheckConfig struct {
+	Path     string `mapstructure:"path"`
+	Optional bool   `mapstructure:"optional"`
+}
+
+// ProxyConfig declares routes that are forwarded to an upstream service as
+// they are, without a hand-written handler. They are registered next to the
+// built-in routes and must not collide with them.
+type ProxyConfig struct {
+	Routes []ProxyRoute `mapstructure:"routes"`
+}
+
+// ProxyRoute forwards Method requests on Path, a gin route template such as
+// /api/v1/reviews/:id, to Service at UpstreamPath. UpstreamPath defaults to
+// Path; its :name and *name segments are filled from the matched route.
+// Routes require authentication unless Public, plus any Permissions; a
+// Public route cannot have Permissions. A RateLimit with a Limit applies to
+// the route ahead of rate_limit.routes, and a Timeout replaces the
+// service's client timeout.
+type ProxyRoute struct {
+	Method       string        `mapstructure:"method"`
+	Path         string        `mapstructure:"path"`
+	Service      string        `mapstructure:"service"`
+	UpstreamPath string        `mapstructure:"upstream_path"`
+	Public       bool          `mapstructure:"public"`
+	Permissions  []string      `mapstructure:"permissions"`
+	RateLimit    RateLimitRule `mapstructure:"rate_limit"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+}
+
+// EffectiveRBAC returns RBAC with a policy for every proxy route that
+// requires permissions, ahead of the configured policies.
+func (c *Config) EffectiveRBAC() RBACConfig {
+	rbac := c.RBAC
+	var policies []PolicyConfig
+	for _, r := range c.Proxy.Routes {
+		if len(r.Permissions) > 0 {
+			policies = append(policies, PolicyConfig{Method: r.Method, Path: r.Path, Permissions: r.Permissions})
+		}
+	}
+	rbac.Policies = append(policies, c.RBAC.Policies...)
+	return rbac
+}
+
+// EffectiveRateLimit returns RateLimit with the rule of every proxy route
+// that sets one, ahead of the configured routes.
+func (c *Config) EffectiveRateLimit() RateLimitConfig {
+	rl := c.RateLimit
+	var routes []RateLimitRule
+	for _, r := range c.Proxy.Routes {
+		if r.RateLimit.Limit > 0 {
+			rule := r.RateLimit
+			rule.Method, rule.Path = r.Method, r.Path
+			routes = append(routes, rule)
+		}
+	}
+	rl.Routes = append(routes, c.RateLimit.Routes...)
+	return rl
+}
+
+// DiscoveryConfig selects where service endpoints come from. Provider is
+// "static" (the services config), "dns" (A or SRV records per service) or
+// "file" (a JSON or YAML file of endpoints per service, reloaded when it
+// changes). Endpoints are looked up again every RefreshInterval; services
+// a provider knows nothing about keep the endpoints in the services config.
+type DiscoveryConfig struct {
+	Provider        string                     `mapstructure:"provider"`
+	RefreshInterval time.Duration              `mapstructure:"refresh_interval"`
+	DNS             map[string]DNSRecordConfig `mapstructure:"dns"`
+	File            string                     `mapstructure:"file"`
+}
+
+// DNSRecordConfig is the DNS name a service is found at, keyed by service
+// name. Type "a" (the default) turns every address of Name into an
+// endpoint on Port; type "srv" takes the host, port and weight of every SRV
+// record of Name (e.g. _http._tcp.order-service). Scheme defaults to http.
+type DNSRecordConfig struct {
+	Name   string `mapstructure:"name"`
+	Type   string `mapstructure:"type"`
+	Port   int    `mapstructure:"port"`
+	Scheme string `mapstructure:"scheme"`
+}
+
+// CacheConfig configures the cache of product catalog reads. Store is
+// "memory", an LRU bounded to MaxBytes of keys and values. Routes holds the
+// settings of each cached read, keyed by "list_products" or "get_product";
+// reads without an entry are not cached. Creating a product or updating
+// stock through the gateway invalidates the affected entries.
+type CacheConfig struct {
+	Enabled  bool                        `mapstructure:"enabled"`
+	Store    string                      `mapstructure:"store"`
+	MaxBytes int64                       `mapstructure:"max_bytes"`
+	Routes   map[string]CacheRouteConfig `mapstructure:"routes"`
+}
+
+// CacheRouteConfig controls one cached read. Entries are fresh for TTL.
+// For StaleWhileRevalidate after that they are still served while being
+// refreshed in the background, and for StaleIfError they are served when
+// the product service fails. PerUser keeps a separate entry per
+// authenticated user (and one for anonymous callers) for responses that
+// depend on who asks.
+type CacheRouteConfig struct {
+	TTL                  time.Duration `mapstructure:"ttl"`
+	StaleWhileRevalidate time.Duration `mapstructure:"stale_while_revalidate"`
+	StaleIfError         time.Duration `mapstructure:"stale_if_error"`
+	PerUser              bool          `mapstructure:"per_user"`
+}
+
+// LoadConfig loads ./config/config.yaml plus environment overrides and
+// exits if the result is invalid.
 func LoadConfig() *Config {
-	viper.AddConfigPath("./config")
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
+	cfg, err := Load("")
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	return cfg
+}
+
+// Load reads the config file at path (./config/config.yaml when empty),
+// applies environment overrides such as SERVICES_USER_SERVICE, and
+// validates the result. Without a config file every setting must come from
+// the environment. Unknown keys in the file are reported along with the
+// other errors.
+func Load(path string) (*Config, error) {
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.AddConfigPath("./config")
+		viper.SetConfigName("config")
+		viper.SetConfigType("yaml")
+	}
 
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	// Make every key known to viper so env vars apply without a config file
+	bindEnv(reflect.TypeOf(Config{}), "")
 
 	if err := viper.ReadInConfig(); err != nil {
-		log.Printf("Error reading config file, using defaults: %v", err)
+		var notFound viper.ConfigFileNotFoundError
+		if path != "" || !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		log.Printf("No config file found, using environment variables only")
 	}
 
+	return decode()
+}
+
+// decode unmarshals and validates the current viper settings.
+func decode() (*Config, error) {
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		log.Fatalf("Unable to decode into struct: %v", err)
+	var md mapstructure.Metadata
+	err := viper.Unmarshal(&config, func(dc *mapstructure.DecoderConfig) {
+		dc.Metadata = &md
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
 	}
 
-	return &config
+	var errs []error
+	sort.Strings(md.Unused)
+	for _, key := range md.Unused {
+		errs = append(errs, fmt.Errorf("%s: unknown key", key))
+	}
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// bindEnv registers the key of every scalar setting in t with viper. Maps
+// and lists can only be set from the config file.
+func bindEnv(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch {
+		case f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Duration(0)):
+			bindEnv(f.Type, key)
+		case f.Type.Kind() == reflect.Map || f.Type.Kind() == reflect.Slice:
+		default:
+			viper.BindEnv(key)
+		}
+	}
 }
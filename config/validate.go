@@ -0,0 +1,462 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit algorithms and client keys accepted in RateLimitRule.
+const (
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitSlidingWindow = "sliding_window"
+
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyAPIKey = "api_key"
+	RateLimitKeyUser   = "user"
+)
+
+// Service discovery providers accepted in DiscoveryConfig.
+const (
+	DiscoveryStatic = "static"
+	DiscoveryDNS    = "dns"
+	DiscoveryFile   = "file"
+)
+
+// Cached reads accepted as keys of CacheConfig.Routes.
+const (
+	CacheListProducts = "list_products"
+	CacheGetProduct   = "get_product"
+)
+
+// Load balancing strategies accepted in BalancerConfig.
+const (
+	BalanceRoundRobin       = "round_robin"
+	BalanceLeastOutstanding = "least_outstanding"
+	BalanceConsistentHash   = "consistent_hash"
+)
+
+var (
+	serverModes  = []string{"debug", "release", "test"}
+	logLevels    = []string{"debug", "info", "warn", "error"}
+	proxyMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+)
+
+// validator collects errors, each prefixed with the key it is about.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(key string, err error) {
+	if err != nil {
+		v.errs = append(v.errs, fmt.Errorf("%s: %w", key, err))
+	}
+}
+
+func (v *validator) failf(key, format string, args ...interface{}) {
+	v.check(key, fmt.Errorf(format, args...))
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.failf(key, "is required")
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.failf(key, "%q is not one of %s", value, strings.Join(allowed, ", "))
+}
+
+func (v *validator) nonNegative(key string, d time.Duration) {
+	if d < 0 {
+		v.failf(key, "must not be negative")
+	}
+}
+
+func (v *validator) percentage(key string, p float64) {
+	if p < 0 || p > 100 {
+		v.failf(key, "must be between 0 and 100")
+	}
+}
+
+func (v *validator) ratio(key string, r float64) {
+	if r < 0 || r > 1 {
+		v.failf(key, "must be between 0 and 1")
+	}
+}
+
+func (v *validator) pattern(key, p string) {
+	if _, err := path.Match(p, ""); err != nil {
+		v.failf(key, "invalid path pattern %q", p)
+	}
+}
+
+// Validate reports every invalid setting in c, each prefixed with its key.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check("server.port", validatePort(c.Server.Port))
+	if c.Server.Mode != "" {
+		v.oneOf("server.mode", c.Server.Mode, serverModes...)
+	}
+	v.nonNegative("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	for i, p := range c.Server.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				v.failf(fmt.Sprintf("server.trusted_proxies[%d]", i), "%q is not an IP or CIDR", p)
+			}
+		}
+	}
+
+	if c.Logger.Level != "" {
+		v.oneOf("logger.level", c.Logger.Level, logLevels...)
+	}
+	v.ratio("logger.access_log.sample_ratio", c.Logger.AccessLog.SampleRatio)
+	for i, r := range c.Logger.AccessLog.Routes {
+		key := fmt.Sprintf("logger.access_log.routes[%d]", i)
+		v.pattern(key+".path", r.Path)
+		v.ratio(key+".sample_ratio", r.SampleRatio)
+	}
+
+	c.Services.validate(v)
+	c.Auth.validate(v, c.Server.Mode)
+
+	for i, p := range c.RBAC.Policies {
+		key := fmt.Sprintf("rbac.policies[%d]", i)
+		v.required(key+".path", p.Path)
+		v.pattern(key+".path", p.Path)
+		if len(p.Permissions) == 0 {
+			v.failf(key+".permissions", "is required")
+		}
+	}
+
+	v.required("checkout.state_dir", c.Checkout.StateDir)
+	v.nonNegative("checkout.timeout", c.Checkout.Timeout)
+
+	if c.Idempotency.Store != "" {
+		v.oneOf("idempotency.store", c.Idempotency.Store, "memory", "file")
+	}
+	if c.Idempotency.Store == "file" {
+		v.required("idempotency.dir", c.Idempotency.Dir)
+	}
+	v.nonNegative("idempotency.ttl", c.Idempotency.TTL)
+	v.nonNegative("idempotency.lease", c.Idempotency.Lease)
+
+	if c.RateLimit.Store != "" {
+		v.oneOf("rate_limit.store", c.RateLimit.Store, "memory")
+	}
+	v.check("rate_limit.default", c.RateLimit.Default.Validate())
+	for i, rule := range c.RateLimit.Routes {
+		key := fmt.Sprintf("rate_limit.routes[%d]", i)
+		v.required(key+".path", rule.Path)
+		v.check(key, rule.Validate())
+	}
+
+	if c.Tracing.Enabled {
+		if c.Tracing.Exporter != "" {
+			v.oneOf("tracing.exporter", c.Tracing.Exporter, "otlp", "stdout", "file")
+		}
+		if c.Tracing.Exporter == "file" {
+			v.required("tracing.file", c.Tracing.File)
+		}
+		v.ratio("tracing.sample_ratio", c.Tracing.SampleRatio)
+	}
+
+	v.nonNegative("health.interval", c.Health.Interval)
+	v.nonNegative("health.timeout", c.Health.Timeout)
+	for name := range c.Health.Services {
+		if _, ok := c.Services.BaseURLs()[name]; !ok {
+			v.failf("health.services."+name, "unknown service")
+		}
+	}
+
+	c.Proxy.validate(v, c.Services.BaseURLs())
+	c.Discovery.validate(v, c.Services.BaseURLs())
+
+	if c.Cache.Store != "" {
+		v.oneOf("cache.store", c.Cache.Store, "memory")
+	}
+	if c.Cache.MaxBytes < 0 {
+		v.failf("cache.max_bytes", "must not be negative")
+	}
+	for _, name := range sortedKeys(c.Cache.Routes) {
+		key := "cache.routes." + name
+		v.oneOf(key, name, CacheListProducts, CacheGetProduct)
+		r := c.Cache.Routes[name]
+		if r.TTL <= 0 {
+			v.failf(key+".ttl", "must be positive")
+		}
+		v.nonNegative(key+".stale_while_revalidate", r.StaleWhileRevalidate)
+		v.nonNegative(key+".stale_if_error", r.StaleIfError)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+func (p ProxyConfig) validate(v *validator, services map[string]string) {
+	seen := make(map[string]bool, len(p.Routes))
+	for i, r := range p.Routes {
+		key := fmt.Sprintf("proxy.routes[%d]", i)
+		v.oneOf(key+".method", strings.ToUpper(r.Method), proxyMethods...)
+		if !strings.HasPrefix(r.Path, "/") {
+			v.failf(key+".path", "%q must start with /", r.Path)
+		}
+		route := strings.ToUpper(r.Method) + " " + r.Path
+		if seen[route] {
+			v.failf(key, "duplicate route %s", route)
+		}
+		seen[route] = true
+
+		if _, ok := services[r.Service]; !ok {
+			v.failf(key+".service", "unknown service %q", r.Service)
+		}
+		if r.UpstreamPath != "" && !strings.HasPrefix(r.UpstreamPath, "/") {
+			v.failf(key+".upstream_path", "%q must start with /", r.UpstreamPath)
+		}
+		params := routeParams(r.Path)
+		for _, name := range sortedKeys(routeParams(r.UpstreamPath)) {
+			if !params[name] {
+				v.failf(key+".upstream_path", "parameter %q is not in path", name)
+			}
+		}
+
+		if r.Public && len(r.Permissions) > 0 {
+			v.failf(key+".permissions", "cannot be set on a public route")
+		}
+
+		rule := r.RateLimit
+		rule.Path = r.Path
+		v.check(key+".rate_limit", rule.Validate())
+		v.nonNegative(key+".timeout", r.Timeout)
+	}
+}
+
+func (d DiscoveryConfig) validate(v *validator, services map[string]string) {
+	if d.Provider != "" {
+		v.oneOf("discovery.provider", d.Provider, DiscoveryStatic, DiscoveryDNS, DiscoveryFile)
+	}
+	v.nonNegative("discovery.refresh_interval", d.RefreshInterval)
+	if d.Provider == DiscoveryFile {
+		v.required("discovery.file", d.File)
+	}
+
+	for _, name := range sortedKeys(d.DNS) {
+		key := "discovery.dns." + name
+		if _, ok := services[name]; !ok {
+			v.failf(key, "unknown service")
+			continue
+		}
+		r := d.DNS[name]
+		v.required(key+".name", r.Name)
+		if r.Type != "" {
+			v.oneOf(key+".type", r.Type, "a", "srv")
+		}
+		if r.Type != "srv" && (r.Port < 1 || r.Port > 65535) {
+			v.failf(key+".port", "must be between 1 and 65535 for A records")
+		}
+		if r.Scheme != "" {
+			v.oneOf(key+".scheme", r.Scheme, "http", "https")
+		}
+	}
+}
+
+// routeParams returns the names of the :name and *name segments of a gin
+// route template.
+func routeParams(route string) map[string]bool {
+	params := make(map[string]bool)
+	for _, seg := range strings.Split(route, "/") {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			params[seg[1:]] = true
+		}
+	}
+	return params
+}
+
+func (s ServicesConfig) validate(v *validator) {
+	urls := s.BaseURLs()
+	for _, name := range sortedKeys(urls) {
+		if len(s.Balancers[name].Endpoints) > 0 {
+			continue
+		}
+		endpoints := s.Endpoints(name)
+		if len(endpoints) == 0 {
+			v.failf("services."+name, "url is required")
+		}
+		for _, e := range endpoints {
+			v.check("services."+name, validateBaseURL(e.URL))
+		}
+	}
+
+	for _, name := range sortedKeys(s.Balancers) {
+		key := "services.balancers." + name
+		if _, ok := urls[name]; !ok && name != DefaultClient {
+			v.failf(key, "unknown service")
+			continue
+		}
+		b := s.Balancers[name]
+		if name == DefaultClient && len(b.Endpoints) > 0 {
+			v.failf(key+".endpoints", "cannot be set on the default entry")
+		}
+		if b.Strategy != "" {
+			v.oneOf(key+".strategy", b.Strategy, BalanceRoundRobin, BalanceLeastOutstanding, BalanceConsistentHash)
+		}
+		for i, e := range b.Endpoints {
+			ekey := fmt.Sprintf("%s.endpoints[%d]", key, i)
+			v.check(ekey+".url", validateBaseURL(e.URL))
+			if e.Weight < 0 {
+				v.failf(ekey+".weight", "must not be negative")
+			}
+		}
+		if b.Outlier.ConsecutiveFailures < 0 {
+			v.failf(key+".outlier.consecutive_failures", "must not be negative")
+		}
+		v.nonNegative(key+".outlier.ejection_time", b.Outlier.EjectionTime)
+		v.percentage(key+".outlier.max_ejection_percent", b.Outlier.MaxEjectionPercent)
+	}
+
+	for _, name := range sortedKeys(s.Clients) {
+		key := "services.clients." + name
+		if _, ok := urls[name]; !ok && name != DefaultClient {
+			v.failf(key, "unknown service")
+			continue
+		}
+		c := s.Clients[name]
+		v.nonNegative(key+".timeout", c.Timeout)
+		v.nonNegative(key+".connect_timeout", c.ConnectTimeout)
+		v.nonNegative(key+".read_timeout", c.ReadTimeout)
+		v.nonNegative(key+".backoff_base", c.BackoffBase)
+		v.nonNegative(key+".backoff_cap", c.BackoffCap)
+		if c.MaxRetries < Disabled {
+			v.failf(key+".max_retries", "must be %d (disabled) or more", Disabled)
+		}
+		for _, code := range c.RetryStatusCodes {
+			if code < 100 || code > 599 {
+				v.failf(key+".retry_status_codes", "%d is not an HTTP status", code)
+			}
+		}
+
+		b := c.Breaker
+		if b.WindowSize < Disabled {
+			v.failf(key+".breaker.window_size", "must be %d (disabled) or more", Disabled)
+		}
+		if b.MinimumCalls < 0 || b.HalfOpenCalls < 0 {
+			v.failf(key+".breaker", "minimum_calls and half_open_calls must not be negative")
+		}
+		v.percentage(key+".breaker.failure_rate_threshold", b.FailureRateThreshold)
+		v.percentage(key+".breaker.slow_call_rate_threshold", b.SlowCallRateThreshold)
+		v.nonNegative(key+".breaker.open_duration", b.OpenDuration)
+	}
+}
+
+func (a AuthConfig) validate(v *validator, mode string) {
+	switch strings.ToUpper(a.Algorithm) {
+	case "", "HS256":
+		if a.Secret == "" && a.SecretPath == "" {
+			v.failf("auth.secret", "secret or secret_path is required for HS256")
+		}
+		if mode == "release" && IsPlaceholderSecret(a.Secret) {
+			v.failf("auth.secret", "placeholder secret is not allowed in release mode")
+		}
+	case "RS256":
+		if a.PublicKey == "" && a.PublicKeyPath == "" {
+			v.failf("auth.public_key", "public_key or public_key_path is required for RS256")
+		}
+	default:
+		v.failf("auth.algorithm", "%q is not one of HS256, RS256", a.Algorithm)
+	}
+}
+
+// placeholderSecrets are sample values from docs and examples that must never
+// sign tokens in production.
+var placeholderSecrets = []string{
+	"change-me", "changeme", "change-this", "secret", "your-secret", "your-secret-key", "jwt-secret",
+}
+
+// IsPlaceholderSecret reports whether secret is a well known sample value.
+func IsPlaceholderSecret(secret string) bool {
+	secret = strings.ToLower(strings.TrimSpace(secret))
+	for _, p := range placeholderSecrets {
+		if secret == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a rate limit rule. Rules with a zero Limit disable
+// limiting and are always valid.
+func (r RateLimitRule) Validate() error {
+	if r.Limit <= 0 {
+		return nil
+	}
+	if r.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	if _, err := path.Match(r.Path, ""); err != nil {
+		return fmt.Errorf("invalid path pattern %q", r.Path)
+	}
+	switch r.Algorithm {
+	case "", RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		return fmt.Errorf("unknown algorithm %q", r.Algorithm)
+	}
+	switch r.Key {
+	case "", RateLimitKeyIP, RateLimitKeyAPIKey, RateLimitKeyUser:
+	default:
+		return fmt.Errorf("unknown key %q", r.Key)
+	}
+	return nil
+}
+
+func validateBaseURL(raw string) error {
+	if raw == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url %q has no host", raw)
+	}
+	return nil
+}
+
+// validatePort accepts a listen address such as ":8080" or "0.0.0.0:8080".
+func validatePort(addr string) error {
+	if addr == "" {
+		return errors.New("is required")
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%q is not a listen address like \":8080\"", addr)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port %q must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
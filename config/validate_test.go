@@ -0,0 +1,332 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// load runs Load on a fresh viper, as a process starting up would.
+func load(t *testing.T, path string) (*Config, error) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	return Load(path)
+}
+
+// shippedConfig loads config.yaml with the secret it leaves to the
+// environment.
+func shippedConfig(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("AUTH_SECRET", testSecret)
+	cfg, err := load(t, "config.yaml")
+	if err != nil {
+		t.Fatalf("config.yaml is invalid: %v", err)
+	}
+	return cfg
+}
+
+// wantErrors checks that err has one line for each prefix in want.
+func wantErrors(t *testing.T, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("unexpected errors:\n%v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("no error, want %q", want)
+	}
+	var got []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if line != "" {
+			got = append(got, line)
+		}
+	}
+	for _, w := range want {
+		found := false
+		for _, line := range got {
+			if strings.HasPrefix(line, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing error %q in:\n%v", w, err)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d errors, want %d:\n%v", len(got), len(want), err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	reviews := func() ProxyRoute {
+		return ProxyRoute{Method: "GET", Path: "/api/v1/products/:id/reviews", Service: "product_service", UpstreamPath: "/products/:id/reviews", Public: true}
+	}
+	client := func(cfg *Config, change func(*ClientConfig)) {
+		c := cfg.Services.Clients[DefaultClient]
+		change(&c)
+		cfg.Services.Clients[DefaultClient] = c
+	}
+
+	tests := []struct {
+		name     string
+		change   func(*Config)
+		wantErrs []string
+	}{
+		{name: "shipped config", change: func(*Config) {}},
+
+		{name: "port", change: func(c *Config) { c.Server.Port = "8080" }, wantErrs: []string{"server.port: "}},
+		{name: "port range", change: func(c *Config) { c.Server.Port = ":70000" }, wantErrs: []string{"server.port: "}},
+		{name: "mode", change: func(c *Config) { c.Server.Mode = "production" }, wantErrs: []string{"server.mode: "}},
+		{name: "trusted proxies", change: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/8", "::1"} }},
+		{
+			name:     "trusted proxy hostname",
+			change:   func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1", "proxy.internal", "10.0.0.0/33"} },
+			wantErrs: []string{"server.trusted_proxies[1]: ", "server.trusted_proxies[2]: "},
+		},
+
+		{name: "service url", change: func(c *Config) { c.Services.OrderService = "" }, wantErrs: []string{"services.order_service: url is required"}},
+		{name: "service scheme", change: func(c *Config) { c.Services.OrderService = "ftp://orders" }, wantErrs: []string{"services.order_service: "}},
+		{
+			name:     "balancer for unknown service",
+			change:   func(c *Config) { c.Services.Balancers["shop_service"] = BalancerConfig{} },
+			wantErrs: []string{"services.balancers.shop_service: unknown service"},
+		},
+		{
+			name: "balancer strategy",
+			change: func(c *Config) {
+				c.Services.Balancers["order_service"] = BalancerConfig{Strategy: "random", Endpoints: []EndpointConfig{{URL: "http://orders:8083"}}}
+			},
+			wantErrs: []string{"services.balancers.order_service.strategy: "},
+		},
+		{name: "retries disabled", change: func(c *Config) { client(c, func(cc *ClientConfig) { cc.MaxRetries = Disabled }) }},
+		{
+			name:     "retries below disabled",
+			change:   func(c *Config) { client(c, func(cc *ClientConfig) { cc.MaxRetries = -2 }) },
+			wantErrs: []string{"services.clients.default.max_retries: "},
+		},
+		{name: "breaker disabled", change: func(c *Config) { client(c, func(cc *ClientConfig) { cc.Breaker.WindowSize = Disabled }) }},
+		{
+			name:     "breaker below disabled",
+			change:   func(c *Config) { client(c, func(cc *ClientConfig) { cc.Breaker.WindowSize = -2 }) },
+			wantErrs: []string{"services.clients.default.breaker.window_size: "},
+		},
+		{
+			name:     "retry status",
+			change:   func(c *Config) { client(c, func(cc *ClientConfig) { cc.RetryStatusCodes = []int{503, 5030} }) },
+			wantErrs: []string{"services.clients.default.retry_status_codes: "},
+		},
+		{
+			name:     "client for unknown service",
+			change:   func(c *Config) { c.Services.Clients["shop_service"] = ClientConfig{} },
+			wantErrs: []string{"services.clients.shop_service: unknown service"},
+		},
+
+		{name: "no secret", change: func(c *Config) { c.Auth.Secret = "" }, wantErrs: []string{"auth.secret: "}},
+		{name: "secret file", change: func(c *Config) { c.Auth.Secret, c.Auth.SecretPath = "", "/run/secrets/jwt" }},
+		{name: "placeholder secret in debug", change: func(c *Config) { c.Auth.Secret = "change-me" }},
+		{
+			name:     "placeholder secret in release",
+			change:   func(c *Config) { c.Server.Mode, c.Auth.Secret = "release", " Change-Me " },
+			wantErrs: []string{"auth.secret: placeholder secret"},
+		},
+		{name: "RS256 without key", change: func(c *Config) { c.Auth.Algorithm = "RS256" }, wantErrs: []string{"auth.public_key: "}},
+		{name: "algorithm", change: func(c *Config) { c.Auth.Algorithm = "ES256" }, wantErrs: []string{"auth.algorithm: "}},
+
+		{
+			name: "policy without permissions",
+			change: func(c *Config) {
+				c.RBAC.Policies = append(c.RBAC.Policies, PolicyConfig{Method: "GET", Path: "/api/v1/orders"})
+			},
+			wantErrs: []string{"rbac.policies[7].permissions: is required"},
+		},
+		{name: "checkout state dir", change: func(c *Config) { c.Checkout.StateDir = "" }, wantErrs: []string{"checkout.state_dir: "}},
+
+		{name: "idempotency store", change: func(c *Config) { c.Idempotency.Store = "redis" }, wantErrs: []string{"idempotency.store: "}},
+		{name: "idempotency file store", change: func(c *Config) { c.Idempotency.Store, c.Idempotency.Dir = "file", "" }, wantErrs: []string{"idempotency.dir: "}},
+		{
+			name:     "idempotency durations",
+			change:   func(c *Config) { c.Idempotency.TTL, c.Idempotency.Lease = -time.Hour, -time.Minute },
+			wantErrs: []string{"idempotency.ttl: ", "idempotency.lease: "},
+		},
+
+		{
+			name:     "rate limit algorithm",
+			change:   func(c *Config) { c.RateLimit.Routes[0].Algorithm = "leaky_bucket" },
+			wantErrs: []string{"rate_limit.routes[0]: unknown algorithm"},
+		},
+		{name: "rate limit window", change: func(c *Config) { c.RateLimit.Default.Window = 0 }, wantErrs: []string{"rate_limit.default: window must be positive"}},
+		{name: "rate limit off", change: func(c *Config) { c.RateLimit.Default = RateLimitRule{Algorithm: "leaky_bucket"} }},
+
+		{name: "health unknown service", change: func(c *Config) { c.Health.Services["shop_service"] = HealthCheckConfig{} }, wantErrs: []string{"health.services.shop_service: "}},
+
+		{name: "proxy route", change: func(c *Config) { c.Proxy.Routes = []ProxyRoute{reviews()} }},
+		{
+			name: "proxy public route with permissions",
+			change: func(c *Config) {
+				r := reviews()
+				r.Permissions = []string{"reviews:read"}
+				c.Proxy.Routes = []ProxyRoute{r}
+			},
+			wantErrs: []string{"proxy.routes[0].permissions: cannot be set on a public route"},
+		},
+		{
+			name: "proxy private route with permissions",
+			change: func(c *Config) {
+				r := reviews()
+				r.Public, r.Permissions = false, []string{"reviews:read"}
+				c.Proxy.Routes = []ProxyRoute{r}
+			},
+		},
+		{
+			name: "proxy route fields",
+			change: func(c *Config) {
+				r := reviews()
+				r.Method, r.Path, r.Service, r.UpstreamPath = "FETCH", "api/v1/reviews", "review_service", "/reviews/:id"
+				c.Proxy.Routes = []ProxyRoute{r}
+			},
+			wantErrs: []string{
+				"proxy.routes[0].method: ",
+				"proxy.routes[0].path: ",
+				"proxy.routes[0].service: ",
+				`proxy.routes[0].upstream_path: parameter "id" is not in path`,
+			},
+		},
+		{
+			name:     "proxy duplicate route",
+			change:   func(c *Config) { c.Proxy.Routes = []ProxyRoute{reviews(), reviews()} },
+			wantErrs: []string{"proxy.routes[1]: duplicate route"},
+		},
+
+		{
+			name: "discovery dns",
+			change: func(c *Config) {
+				c.Discovery.DNS = map[string]DNSRecordConfig{"order_service": {Name: "orders"}, "shop_service": {Name: "shop"}}
+			},
+			wantErrs: []string{"discovery.dns.order_service.port: ", "discovery.dns.shop_service: unknown service"},
+		},
+		{name: "discovery srv", change: func(c *Config) {
+			c.Discovery.DNS = map[string]DNSRecordConfig{"order_service": {Name: "_http._tcp.orders", Type: "srv"}}
+		}},
+
+		{
+			name:     "cache route",
+			change:   func(c *Config) { c.Cache.Routes["list_orders"] = CacheRouteConfig{TTL: time.Second} },
+			wantErrs: []string{"cache.routes.list_orders: "},
+		},
+		{
+			name: "cache ttl",
+			change: func(c *Config) {
+				c.Cache.Routes[CacheGetProduct] = CacheRouteConfig{StaleIfError: -time.Second}
+			},
+			wantErrs: []string{"cache.routes.get_product.ttl: ", "cache.routes.get_product.stale_if_error: "},
+		},
+
+		{
+			name: "every error is reported",
+			change: func(c *Config) {
+				c.Server.Port = ""
+				c.Auth.Secret = ""
+				c.Checkout.StateDir = ""
+			},
+			wantErrs: []string{"server.port: ", "auth.secret: ", "checkout.state_dir: "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := shippedConfig(t)
+			tt.change(cfg)
+			wantErrors(t, cfg.Validate(), tt.wantErrs)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	const base = `
+server:
+  port: ":8080"
+services:
+  user_service: "http://users:8081"
+  product_service: "http://products:8082"
+  order_service: "http://orders:8083"
+  payment_service: "http://payments:8084"
+  inventory_service: "http://inventory:8085"
+  notification_service: "http://notifications:8086"
+auth:
+  secret: "` + testSecret + `"
+checkout:
+  state_dir: "./data/checkout"
+`
+	tests := []struct {
+		name     string
+		yaml     string
+		env      map[string]string
+		wantErrs []string
+		check    func(t *testing.T, cfg *Config)
+	}{
+		{name: "minimal", yaml: base},
+		{
+			name:     "unknown keys",
+			yaml:     base + "cahce:\n  enabled: true\nidempotency:\n  leese: \"1m\"\n",
+			wantErrs: []string{"cahce: unknown key", "idempotency.leese: unknown key"},
+		},
+		{
+			name:     "unknown key in a list",
+			yaml:     base + "proxy:\n  routes:\n    - method: GET\n      path: /api/v1/reviews\n      service: product_service\n      pubilc: true\n",
+			wantErrs: []string{"proxy.routes[0].pubilc: unknown key"},
+		},
+		{
+			name:     "unknown keys and invalid values",
+			yaml:     base + "health:\n  intervall: 10s\n  timeout: -1s\n",
+			wantErrs: []string{"health.intervall: unknown key", "health.timeout: "},
+		},
+		{
+			name:     "wrong type",
+			yaml:     base + "idempotency:\n  ttl: soon\n",
+			wantErrs: []string{"decode config: ", "'idempotency.ttl' time: invalid duration"},
+		},
+		{
+			name: "environment overrides",
+			yaml: base,
+			env:  map[string]string{"SERVICES_ORDER_SERVICE": "http://orders-a:8083,http://orders-b:8083", "IDEMPOTENCY_LEASE": "5m"},
+			check: func(t *testing.T, cfg *Config) {
+				if n := len(cfg.Services.Endpoints("order_service")); n != 2 {
+					t.Errorf("order_service has %d endpoints, want 2", n)
+				}
+				if cfg.Idempotency.Lease != 5*time.Minute {
+					t.Errorf("idempotency.lease = %v, want 5m", cfg.Idempotency.Lease)
+				}
+			},
+		},
+		{
+			name:     "invalid environment override",
+			yaml:     base,
+			env:      map[string]string{"SERVER_MODE": "production"},
+			wantErrs: []string{"server.mode: "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := load(t, path)
+			wantErrors(t, err, tt.wantErrs)
+			if err == nil && tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
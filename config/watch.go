@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Change is one setting that differs between two loads of the config.
+// Old or New is nil when the key was added or removed.
+type Change struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Key, c.Old, c.New)
+}
+
+// redactedKeys are replaced in diffs so secrets never reach the logs.
+var redactedKeys = []string{"secret", "public_key", "password", "token"}
+
+// Watch reloads the config file whenever it changes. The new config is
+// validated first: onChange gets it with the list of changed settings,
+// while onError gets the reason it was rejected and the previous config
+// stays in effect. Saves that change nothing are ignored. Watch does
+// nothing when no config file was loaded.
+func Watch(onChange func(next *Config, changes []Change), onError func(error)) {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+
+	var mu sync.Mutex
+	applied := flatten("", viper.AllSettings())
+
+	viper.OnConfigChange(func(fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		next, err := decode()
+		if err != nil {
+			onError(err)
+			return
+		}
+
+		settings := flatten("", viper.AllSettings())
+		changes := diff(applied, settings)
+		if len(changes) == 0 {
+			return
+		}
+		applied = settings
+		onChange(next, changes)
+	})
+	viper.WatchConfig()
+}
+
+// flatten turns nested settings into dotted keys (e.g. services.user_service).
+func flatten(prefix string, settings map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range settings {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			for nk, nv := range flatten(key, nested) {
+				out[nk] = nv
+			}
+			continue
+		}
+		out[key] = v
+	}
+	return out
+}
+
+func diff(old, new map[string]interface{}) []Change {
+	var changes []Change
+	for k, nv := range new {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, nv) {
+			changes = append(changes, redact(Change{Key: k, Old: old[k], New: nv}))
+		}
+	}
+	for k, ov := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, redact(Change{Key: k, Old: ov}))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func redact(c Change) Change {
+	for _, k := range redactedKeys {
+		if strings.Contains(c.Key, k) {
+			if c.Old != nil {
+				c.Old = "[redacted]"
+			}
+			if c.New != nil {
+				c.New = "[redacted]"
+			}
+		}
+	}
+	return c
+}
+
+// EffectiveSettings returns the loaded settings, environment overrides
+// included, with secrets masked.
+func EffectiveSettings() map[string]interface{} {
+	return mask("", viper.AllSettings())
+}
+
+func mask(prefix string, settings map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			out[k] = mask(key, nested)
+			continue
+		}
+		out[k] = redact(Change{Key: key, New: v}).New
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+package models
+
+type CheckoutRequest struct {
+	Items         []OrderItemRequest `json:"items" binding:"required,min=1,dive"`
+	PaymentMethod string             `json:"payment_method" binding:"required,oneof=credit_card paypal"`
+}
+
+type CheckoutResult struct {
+	CheckoutID string   `json:"checkout_id"`
+	Status     string   `json:"status"`
+	Order      *Order   `json:"order,omitempty"`
+	Payment    *Payment `json:"payment,omitempty"`
+}
@@ -14,3 +14,46 @@ type CreateProductRequest struct {
 	Price       float64 `json:"price" binding:"required,gt=0"`
 	Stock       int     `json:"stock" binding:"required,gte=0"`
 }
+
+// UpdateProductRequest replaces a product. PATCH requests are merged into
+// the current product and validated as one.
+type UpdateProductRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price" binding:"required,gt=0"`
+	Stock       int     `json:"stock" binding:"gte=0"`
+}
+
+// DefaultProductPageSize is the page size of product listings that do not
+// set page_size.
+const DefaultProductPageSize = 20
+
+// ProductQuery filters, sorts and pages the product listing. A listing is
+// paged either by page number or by the cursor returned with the previous
+// page. Sort lists the fields to order by, each descending when prefixed
+// with "-".
+type ProductQuery struct {
+	Page     int      `form:"page" binding:"omitempty,min=1,max=10000,excluded_with=Cursor"`
+	PageSize int      `form:"page_size" binding:"omitempty,min=1,max=100"`
+	Cursor   string   `form:"cursor" binding:"max=512"`
+	MinPrice *float64 `form:"min_price" binding:"omitempty,gte=0"`
+	MaxPrice *float64 `form:"max_price" binding:"omitempty,gte=0"`
+	Search   string   `form:"search" binding:"max=100"`
+	InStock  *bool    `form:"in_stock"`
+	Sort     []string `form:"sort" collection_format:"csv" binding:"max=4,dive,oneof=id -id name -name price -price stock -stock"`
+}
+
+// Pagination describes where a page sits in a listing. Page is set when
+// the listing was paged by number; NextCursor is empty on the last page.
+type Pagination struct {
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ProductPage is one page of the product listing.
+type ProductPage struct {
+	Products []Product `json:"products"`
+	Pagination
+}
@@ -14,6 +14,15 @@ type CreateUserRequest struct {
 	LastName  string `json:"last_name"`
 }
 
+// UpdateUserRequest replaces a user's profile. PATCH requests are merged
+// into the current profile and validated as one. Passwords are not changed
+// this way.
+type UpdateUserRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMaxBytes = 64 << 20
+
+// memoryStore is an LRU cache bounded by the size of its keys and values.
+// Once full, storing an entry evicts the least recently used ones.
+type memoryStore struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	bytes int64
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+
+	now func() time.Time
+}
+
+type memoryItem struct {
+	key       string
+	entry     Entry
+	expiresAt time.Time
+}
+
+func (it *memoryItem) size() int64 {
+	return int64(len(it.key) + len(it.entry.Value))
+}
+
+func NewMemoryStore(maxBytes int64) Store {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	return &memoryStore{maxBytes: maxBytes, order: list.New(), items: make(map[string]*list.Element), now: time.Now}
+}
+
+func (s *memoryStore) Get(key string) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return Entry{}, false, nil
+	}
+	it := el.Value.(*memoryItem)
+	if !s.now().Before(it.expiresAt) {
+		s.remove(el)
+		return Entry{}, false, nil
+	}
+	s.order.MoveToFront(el)
+	return it.entry, true, nil
+}
+
+func (s *memoryStore) Set(key string, e Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	it := &memoryItem{key: key, entry: e, expiresAt: s.now().Add(ttl)}
+	if it.size() > s.maxBytes {
+		// Would evict everything else and still not fit
+		return nil
+	}
+	s.items[key] = s.order.PushFront(it)
+	s.bytes += it.size()
+	for s.bytes > s.maxBytes {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) DeletePrefix(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, el := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(el)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) remove(el *list.Element) {
+	it := s.order.Remove(el).(*memoryItem)
+	delete(s.items, it.key)
+	s.bytes -= it.size()
+}
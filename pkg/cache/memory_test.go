@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// op is one store call at offset at from the start of the test clock: a Set
+// of an entry of size bytes, key included, a Get, or a DeletePrefix.
+type op struct {
+	at     time.Duration
+	do     string // "set", "get" or "delete"
+	key    string
+	size   int
+	ttl    time.Duration
+	wantOK bool // get: whether the key is found
+}
+
+func TestMemoryStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		ops      []op
+		wantKeys []string // most recently used first
+	}{
+		{
+			name:     "evicts the least recently stored",
+			maxBytes: 30,
+			ops: []op{
+				{do: "set", key: "a", size: 9, ttl: time.Hour},
+				{do: "set", key: "b", size: 9, ttl: time.Hour},
+				{do: "set", key: "c", size: 9, ttl: time.Hour},
+				{do: "set", key: "d", size: 9, ttl: time.Hour},
+				{do: "get", key: "a"},
+			},
+			wantKeys: []string{"d", "c", "b"},
+		},
+		{
+			name:     "reads count as use",
+			maxBytes: 30,
+			ops: []op{
+				{do: "set", key: "a", size: 9, ttl: time.Hour},
+				{do: "set", key: "b", size: 9, ttl: time.Hour},
+				{do: "set", key: "c", size: 9, ttl: time.Hour},
+				{do: "get", key: "a", wantOK: true},
+				{do: "set", key: "d", size: 9, ttl: time.Hour},
+			},
+			wantKeys: []string{"d", "a", "c"},
+		},
+		{
+			name:     "large entry evicts several",
+			maxBytes: 30,
+			ops: []op{
+				{do: "set", key: "a", size: 9, ttl: time.Hour},
+				{do: "set", key: "b", size: 9, ttl: time.Hour},
+				{do: "set", key: "c", size: 9, ttl: time.Hour},
+				{do: "set", key: "d", size: 19, ttl: time.Hour},
+			},
+			wantKeys: []string{"d", "c"},
+		},
+		{
+			name:     "replacing an entry frees its size",
+			maxBytes: 30,
+			ops: []op{
+				{do: "set", key: "a", size: 9, ttl: time.Hour},
+				{do: "set", key: "b", size: 19, ttl: time.Hour},
+				{do: "set", key: "b", size: 9, ttl: time.Hour},
+				{do: "set", key: "c", size: 9, ttl: time.Hour},
+			},
+			wantKeys: []string{"c", "b", "a"},
+		},
+		{
+			name:     "entry larger than the cache is not stored",
+			maxBytes: 30,
+			ops: []op{
+				{do: "set", key: "a", size: 9, ttl: time.Hour},
+				{do: "set", key: "b", size: 31, ttl: time.Hour},
+				{do: "get", key: "b"},
+			},
+			wantKeys: []string{"a"},
+		},
+		{
+			name:     "expiry",
+			maxBytes: 30,
+			ops: []op{
+				{do: "set", key: "a", size: 9, ttl: time.Minute},
+				{at: time.Minute - time.Second, do: "get", key: "a", wantOK: true},
+				{at: time.Minute, do: "get", key: "a"},
+			},
+			wantKeys: []string{},
+		},
+		{
+			name:     "delete prefix",
+			maxBytes: 100,
+			ops: []op{
+				{do: "set", key: "products:1", size: 20, ttl: time.Hour},
+				{do: "set", key: "orders:1", size: 20, ttl: time.Hour},
+				{do: "set", key: "products:2", size: 20, ttl: time.Hour},
+				{do: "delete", key: "products:"},
+			},
+			wantKeys: []string{"orders:1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(tt.maxBytes).(*memoryStore)
+			start := time.Unix(1_000_000, 0)
+			now := start
+			s.now = func() time.Time { return now }
+
+			for i, o := range tt.ops {
+				now = start.Add(o.at)
+				switch o.do {
+				case "set":
+					value := make([]byte, o.size-len(o.key))
+					if err := s.Set(o.key, Entry{Value: value, StoredAt: now}, o.ttl); err != nil {
+						t.Fatalf("op %d: Set(%s) = %v", i, o.key, err)
+					}
+				case "get":
+					if _, ok, err := s.Get(o.key); err != nil || ok != o.wantOK {
+						t.Errorf("op %d: Get(%s) found = %v, %v, want %v", i, o.key, ok, err, o.wantOK)
+					}
+				case "delete":
+					if err := s.DeletePrefix(o.key); err != nil {
+						t.Fatalf("op %d: DeletePrefix(%s) = %v", i, o.key, err)
+					}
+				}
+			}
+
+			keys := []string{}
+			var bytes int64
+			for el := s.order.Front(); el != nil; el = el.Next() {
+				it := el.Value.(*memoryItem)
+				keys = append(keys, it.key)
+				bytes += it.size()
+			}
+			if !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if bytes != s.bytes || bytes > s.maxBytes || len(s.items) != len(keys) {
+				t.Errorf("accounted %d bytes for %d items, hold %d bytes in %d items, max %d", s.bytes, len(s.items), bytes, len(keys), s.maxBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+// Entry is one cached response body and when it was stored.
+type Entry struct {
+	Value    []byte
+	StoredAt time.Time
+}
+
+// Store keeps cache entries. The memory store is local to one gateway
+// instance; a shared backend (e.g. Redis) implements the same interface.
+type Store interface {
+	// Get returns the entry for key, if it is present and not expired.
+	Get(key string) (Entry, bool, error)
+	// Set stores e under key until it expires after ttl.
+	Set(key string, e Entry, ttl time.Duration) error
+	// DeletePrefix drops every entry whose key starts with prefix.
+	DeletePrefix(prefix string) error
+}
+
+// NewStore builds the store selected by cfg.Store. Only "memory" is built
+// in; other backends are passed to the services directly.
+func NewStore(cfg config.CacheConfig) (Store, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return NewMemoryStore(cfg.MaxBytes), nil
+	default:
+		return nil, fmt.Errorf("unknown cache store %q", cfg.Store)
+	}
+}
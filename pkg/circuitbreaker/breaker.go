@@ -0,0 +1,249 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// OpenError is returned by Allow while the breaker rejects calls.
+type OpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s circuit breaker is open", e.Name)
+}
+
+// Snapshot is a point-in-time view of a breaker, used by the admin endpoint.
+type Snapshot struct {
+	Name         string     `json:"name"`
+	State        string     `json:"state"`
+	Calls        int        `json:"calls"`
+	FailureRate  float64    `json:"failure_rate"`
+	SlowCallRate float64    `json:"slow_call_rate"`
+	Rejected     uint64     `json:"rejected"`
+	OpenedAt     *time.Time `json:"opened_at,omitempty"`
+}
+
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+// Breaker is a count-based circuit breaker. It opens when the failure rate or
+// the slow-call rate over the last WindowSize calls crosses its threshold,
+// rejects calls for OpenDuration, then lets HalfOpenCalls trial calls through:
+// one failure re-opens it, all succeeding closes it.
+//
+// A nil *Breaker allows every call.
+type Breaker struct {
+	name string
+	cfg  config.BreakerConfig
+
+	mu       sync.Mutex
+	state    State
+	window   []outcome
+	next     int
+	filled   int
+	openedAt time.Time
+	trials   int
+	passed   int
+	rejected uint64
+
+	onStateChange func(name string, from, to State)
+	now           func() time.Time
+}
+
+// New returns a breaker for cfg, or nil when cfg.WindowSize is zero.
+func New(name string, cfg config.BreakerConfig) *Breaker {
+	if cfg.WindowSize <= 0 {
+		return nil
+	}
+	if cfg.MinimumCalls <= 0 || cfg.MinimumCalls > cfg.WindowSize {
+		cfg.MinimumCalls = cfg.WindowSize
+	}
+	if cfg.HalfOpenCalls <= 0 {
+		cfg.HalfOpenCalls = 1
+	}
+	return &Breaker{name: name, cfg: cfg, window: make([]outcome, cfg.WindowSize), now: time.Now}
+}
+
+// OnStateChange registers fn to be called (outside the lock) on every transition.
+func (b *Breaker) OnStateChange(fn func(name string, from, to State)) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.onStateChange = fn
+	b.mu.Unlock()
+}
+
+func (b *Breaker) Name() string {
+	if b == nil {
+		return ""
+	}
+	return b.name
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be
+// followed by exactly one Done.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	from := b.state
+
+	if b.state == StateOpen {
+		wait := b.cfg.OpenDuration - b.now().Sub(b.openedAt)
+		if wait > 0 {
+			b.rejected++
+			b.mu.Unlock()
+			return &OpenError{Name: b.name, RetryAfter: wait}
+		}
+		b.setState(StateHalfOpen)
+	}
+
+	if b.state == StateHalfOpen {
+		if b.trials >= b.cfg.HalfOpenCalls {
+			b.rejected++
+			b.mu.Unlock()
+			return &OpenError{Name: b.name, RetryAfter: time.Second}
+		}
+		b.trials++
+	}
+
+	to, fn := b.state, b.onStateChange
+	b.mu.Unlock()
+	notify(fn, b.name, from, to)
+	return nil
+}
+
+// Done records the outcome of a call permitted by Allow.
+func (b *Breaker) Done(failed bool, elapsed time.Duration) {
+	if b == nil {
+		return
+	}
+	slow := b.cfg.SlowCallThreshold > 0 && elapsed >= b.cfg.SlowCallThreshold
+
+	b.mu.Lock()
+	from := b.state
+
+	switch b.state {
+	case StateHalfOpen:
+		if failed || slow {
+			b.trip()
+		} else if b.passed++; b.passed >= b.cfg.HalfOpenCalls {
+			b.reset()
+		}
+	case StateClosed:
+		b.window[b.next] = outcome{failed: failed, slow: slow}
+		b.next = (b.next + 1) % len(b.window)
+		if b.filled < len(b.window) {
+			b.filled++
+		}
+		if b.filled >= b.cfg.MinimumCalls {
+			failureRate, slowRate := b.rates()
+			if (b.cfg.FailureRateThreshold > 0 && failureRate >= b.cfg.FailureRateThreshold) ||
+				(b.cfg.SlowCallRateThreshold > 0 && slowRate >= b.cfg.SlowCallRateThreshold) {
+				b.trip()
+			}
+		}
+	}
+
+	to, fn := b.state, b.onStateChange
+	b.mu.Unlock()
+	notify(fn, b.name, from, to)
+}
+
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failureRate, slowRate := b.rates()
+	snap := Snapshot{
+		Name:         b.name,
+		State:        b.state.String(),
+		Calls:        b.filled,
+		FailureRate:  failureRate,
+		SlowCallRate: slowRate,
+		Rejected:     b.rejected,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		snap.OpenedAt = &openedAt
+	}
+	return snap
+}
+
+// rates returns the failure and slow-call percentages over the window.
+func (b *Breaker) rates() (float64, float64) {
+	if b.filled == 0 {
+		return 0, 0
+	}
+	var failed, slow int
+	for _, o := range b.window[:b.filled] {
+		if o.failed {
+			failed++
+		}
+		if o.slow {
+			slow++
+		}
+	}
+	n := float64(b.filled)
+	return float64(failed) / n * 100, float64(slow) / n * 100
+}
+
+func (b *Breaker) trip() {
+	b.setState(StateOpen)
+	b.openedAt = b.now()
+}
+
+func (b *Breaker) reset() {
+	b.setState(StateClosed)
+	b.filled, b.next = 0, 0
+}
+
+func (b *Breaker) setState(s State) {
+	b.state = s
+	b.trials, b.passed = 0, 0
+}
+
+func notify(fn func(string, State, State), name string, from, to State) {
+	if fn != nil && from != to {
+		fn(name, from, to)
+	}
+}
@@ -0,0 +1,215 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+// step is one action against a breaker: "ok", "fail" and "slow" are an
+// allowed call with that outcome, "allow" starts a call without finishing
+// it, "done" finishes one successfully, "reject" expects Allow to fail and
+// "wait" advances the clock by d.
+type step struct {
+	op   string
+	d    time.Duration
+	want State
+}
+
+func TestBreaker(t *testing.T) {
+	base := config.BreakerConfig{
+		WindowSize:           4,
+		MinimumCalls:         4,
+		FailureRateThreshold: 50,
+		OpenDuration:         10 * time.Second,
+		HalfOpenCalls:        1,
+	}
+	with := func(change func(*config.BreakerConfig)) config.BreakerConfig {
+		cfg := base
+		change(&cfg)
+		return cfg
+	}
+	trip := []step{{"fail", 0, StateClosed}, {"fail", 0, StateClosed}, {"fail", 0, StateClosed}, {"fail", 0, StateOpen}}
+
+	tests := []struct {
+		name  string
+		cfg   config.BreakerConfig
+		steps []step
+	}{
+		{
+			name: "stays closed until minimum calls",
+			cfg:  base,
+			steps: []step{
+				{"fail", 0, StateClosed},
+				{"fail", 0, StateClosed},
+				{"fail", 0, StateClosed},
+				{"ok", 0, StateOpen},
+			},
+		},
+		{
+			name: "minimum calls below window size",
+			cfg:  with(func(c *config.BreakerConfig) { c.WindowSize, c.MinimumCalls = 10, 2 }),
+			steps: []step{
+				{"ok", 0, StateClosed},
+				{"fail", 0, StateOpen},
+			},
+		},
+		{
+			name: "failure rate over a rolling window",
+			cfg:  base,
+			steps: []step{
+				{"ok", 0, StateClosed},
+				{"ok", 0, StateClosed},
+				{"ok", 0, StateClosed},
+				{"fail", 0, StateClosed}, // 25%
+				{"ok", 0, StateClosed},   // replaces the first ok: still 25%
+				{"fail", 0, StateOpen},   // replaces the second ok: 50%
+			},
+		},
+		{
+			name: "open rejects until open duration passes",
+			cfg:  base,
+			steps: append(append([]step{}, trip...),
+				step{"reject", 0, StateOpen},
+				step{"wait", 9 * time.Second, StateOpen},
+				step{"reject", 0, StateOpen},
+				step{"wait", time.Second, StateOpen},
+				step{"allow", 0, StateHalfOpen},
+				step{"done", 0, StateClosed},
+			),
+		},
+		{
+			name: "failed trial reopens for a full open duration",
+			cfg:  base,
+			steps: append(append([]step{}, trip...),
+				step{"wait", 10 * time.Second, StateOpen},
+				step{"fail", 0, StateOpen},
+				step{"wait", 9 * time.Second, StateOpen},
+				step{"reject", 0, StateOpen},
+				step{"wait", time.Second, StateOpen},
+				step{"ok", 0, StateClosed},
+			),
+		},
+		{
+			name: "half-open admits only half_open_calls trials",
+			cfg:  with(func(c *config.BreakerConfig) { c.HalfOpenCalls = 2 }),
+			steps: append(append([]step{}, trip...),
+				step{"wait", 10 * time.Second, StateOpen},
+				step{"allow", 0, StateHalfOpen},
+				step{"allow", 0, StateHalfOpen},
+				step{"reject", 0, StateHalfOpen},
+				step{"done", 0, StateHalfOpen},
+				step{"reject", 0, StateHalfOpen},
+				step{"done", 0, StateClosed},
+			),
+		},
+		{
+			name: "closing clears the window",
+			cfg:  base,
+			steps: append(append([]step{}, trip...),
+				step{"wait", 10 * time.Second, StateOpen},
+				step{"ok", 0, StateClosed},
+				step{"fail", 0, StateClosed},
+				step{"fail", 0, StateClosed},
+				step{"fail", 0, StateClosed},
+				step{"fail", 0, StateOpen},
+			),
+		},
+		{
+			name: "slow call rate",
+			cfg: with(func(c *config.BreakerConfig) {
+				c.FailureRateThreshold = 0
+				c.SlowCallThreshold = time.Second
+				c.SlowCallRateThreshold = 50
+			}),
+			steps: []step{
+				{"fail", 0, StateClosed},
+				{"slow", 999 * time.Millisecond, StateClosed},
+				{"slow", time.Second, StateClosed},
+				{"slow", 2 * time.Second, StateOpen},
+			},
+		},
+		{
+			name: "slow trial reopens",
+			cfg: with(func(c *config.BreakerConfig) {
+				c.SlowCallThreshold = time.Second
+				c.SlowCallRateThreshold = 100
+			}),
+			steps: append(append([]step{}, trip...),
+				step{"wait", 10 * time.Second, StateOpen},
+				step{"slow", time.Second, StateOpen},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			b := New("test", tt.cfg)
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				switch s.op {
+				case "ok", "fail", "slow":
+					if err := b.Allow(); err != nil {
+						t.Fatalf("step %d (%s): Allow() = %v", i, s.op, err)
+					}
+					b.Done(s.op == "fail", s.d)
+				case "allow":
+					if err := b.Allow(); err != nil {
+						t.Fatalf("step %d (allow): Allow() = %v", i, err)
+					}
+				case "done":
+					b.Done(false, 0)
+				case "reject":
+					var openErr *OpenError
+					if err := b.Allow(); !errors.As(err, &openErr) {
+						t.Fatalf("step %d (reject): Allow() = %v, want *OpenError", i, err)
+					}
+				case "wait":
+					now = now.Add(s.d)
+				}
+				if got := b.State(); got != s.want {
+					t.Fatalf("step %d (%s): state = %s, want %s", i, s.op, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerRetryAfter(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := New("test", config.BreakerConfig{WindowSize: 1, FailureRateThreshold: 50, OpenDuration: 10 * time.Second})
+	b.now = func() time.Time { return now }
+
+	b.Allow()
+	b.Done(true, 0)
+	now = now.Add(4 * time.Second)
+
+	var openErr *OpenError
+	if err := b.Allow(); !errors.As(err, &openErr) {
+		t.Fatalf("Allow() = %v, want *OpenError", err)
+	}
+	if openErr.RetryAfter != 6*time.Second {
+		t.Errorf("RetryAfter = %v, want 6s", openErr.RetryAfter)
+	}
+	if snap := b.Snapshot(); snap.Rejected != 1 || snap.OpenedAt == nil || !snap.OpenedAt.Equal(time.Unix(0, 0)) {
+		t.Errorf("Snapshot() = %+v, want 1 rejected call, opened at the epoch", snap)
+	}
+}
+
+func TestNilBreakerAllowsEverything(t *testing.T) {
+	b := New("test", config.BreakerConfig{})
+	if b != nil {
+		t.Fatalf("New() with window_size 0 = %v, want nil", b)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("Allow() = %v, want nil", err)
+	}
+	b.Done(true, 0)
+	if got := b.State(); got != StateClosed {
+		t.Errorf("State() = %s, want closed", got)
+	}
+}
@@ -0,0 +1,67 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+// dnsProvider looks services up in DNS, e.g. the names docker-compose gives
+// to a scaled service, which resolve to the address of every replica.
+type dnsProvider struct {
+	records  map[string]config.DNSRecordConfig
+	resolver *net.Resolver
+}
+
+func NewDNSProvider(records map[string]config.DNSRecordConfig) Provider {
+	return &dnsProvider{records: records, resolver: net.DefaultResolver}
+}
+
+func (p *dnsProvider) Resolve(ctx context.Context, service string) ([]config.EndpointConfig, error) {
+	r, ok := p.records[service]
+	if !ok {
+		return nil, nil
+	}
+	scheme := r.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	var endpoints []config.EndpointConfig
+	if strings.EqualFold(r.Type, "srv") {
+		_, srvs, err := p.resolver.LookupSRV(ctx, "", "", r.Name)
+		if err != nil {
+			return nil, fmt.Errorf("lookup SRV %s: %w", r.Name, err)
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			endpoints = append(endpoints, config.EndpointConfig{
+				URL:    scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+				Weight: max(int(srv.Weight), 1),
+			})
+		}
+	} else {
+		addrs, err := p.resolver.LookupHost(ctx, r.Name)
+		if err != nil {
+			return nil, fmt.Errorf("lookup %s: %w", r.Name, err)
+		}
+		for _, addr := range addrs {
+			endpoints = append(endpoints, config.EndpointConfig{
+				URL:    scheme + "://" + net.JoinHostPort(addr, strconv.Itoa(r.Port)),
+				Weight: 1,
+			})
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no records for %s", r.Name)
+	}
+
+	// DNS answers come in any order; sort so an unchanged set compares equal
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].URL < endpoints[j].URL })
+	return endpoints, nil
+}
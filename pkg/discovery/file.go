@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/logger"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
+// fileProvider reads endpoints from a JSON or YAML file keyed by service
+// name:
+//
+//	order_service:
+//	  - url: http://10.0.0.5:8083
+//	    weight: 2
+//	  - url: http://10.0.0.6:8083
+type fileProvider struct {
+	path string
+}
+
+type fileEndpoint struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+func NewFileProvider(path string) (Provider, error) {
+	if path == "" {
+		return nil, errors.New("discovery file is required for the file provider")
+	}
+	return &fileProvider{path: path}, nil
+}
+
+// Resolve reads the file on every call, so a service removed from it goes
+// back to the services config.
+func (p *fileProvider) Resolve(_ context.Context, service string) ([]config.EndpointConfig, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("read discovery file: %w", err)
+	}
+	// YAML is a superset of JSON, so one parser reads both
+	var services map[string][]fileEndpoint
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("parse discovery file: %w", err)
+	}
+
+	var endpoints []config.EndpointConfig
+	for _, e := range services[service] {
+		if e.URL == "" {
+			return nil, fmt.Errorf("discovery file: %s has an endpoint without url", service)
+		}
+		endpoints = append(endpoints, config.EndpointConfig{URL: e.URL, Weight: max(e.Weight, 1)})
+	}
+	return endpoints, nil
+}
+
+// Notify signals whenever the file is written, created or replaced. The
+// directory is watched because editors and config management tools often
+// replace the file rather than write to it.
+func (p *fileProvider) Notify(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Log.Warn("Cannot watch discovery file, polling only", zap.Error(err))
+		return ch
+	}
+	if err := watcher.Add(filepath.Dir(p.path)); err != nil {
+		watcher.Close()
+		logger.Log.Warn("Cannot watch discovery file, polling only", zap.Error(err))
+		return ch
+	}
+
+	name := filepath.Clean(p.path)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != name || ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Log.Warn("Discovery file watch error", zap.Error(err))
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+const defaultRefreshInterval = 30 * time.Second
+
+// Provider finds the endpoints of upstream services.
+type Provider interface {
+	// Resolve returns the current endpoints of service, or none when the
+	// provider does not know the service and the services config applies.
+	Resolve(ctx context.Context, service string) ([]config.EndpointConfig, error)
+}
+
+// Notifier is implemented by providers that learn about changes themselves,
+// so Watch refreshes at once instead of at the next interval.
+type Notifier interface {
+	Notify(ctx context.Context) <-chan struct{}
+}
+
+// NewProvider builds the provider selected by cfg.Provider ("static",
+// "dns" or "file").
+func NewProvider(cfg config.DiscoveryConfig) (Provider, error) {
+	switch cfg.Provider {
+	case "", config.DiscoveryStatic:
+		return Static{}, nil
+	case config.DiscoveryDNS:
+		return NewDNSProvider(cfg.DNS), nil
+	case config.DiscoveryFile:
+		return NewFileProvider(cfg.File)
+	default:
+		return nil, fmt.Errorf("unknown discovery provider %q", cfg.Provider)
+	}
+}
+
+// Static leaves every service at the endpoints in the services config,
+// which config reloads keep up to date.
+type Static struct{}
+
+func (Static) Resolve(context.Context, string) ([]config.EndpointConfig, error) {
+	return nil, nil
+}
+
+// Watch resolves every service now and then every interval (and whenever
+// p notifies) until ctx is done, calling onChange for each service whose
+// endpoints differ from the last lookup. A failed lookup keeps the last
+// endpoints and is passed to onError.
+func Watch(ctx context.Context, p Provider, services []string, interval time.Duration,
+	onChange func(service string, endpoints []config.EndpointConfig), onError func(service string, err error)) {
+	if _, static := p.(Static); static {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	var notify <-chan struct{}
+	if n, ok := p.(Notifier); ok {
+		notify = n.Notify(ctx)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := make(map[string][]config.EndpointConfig, len(services))
+		for {
+			for _, name := range services {
+				endpoints, err := p.Resolve(ctx, name)
+				if err != nil {
+					if ctx.Err() == nil {
+						onError(name, err)
+					}
+					continue
+				}
+				if prev, seen := last[name]; !seen || !reflect.DeepEqual(prev, endpoints) {
+					last[name] = endpoints
+					onChange(name, endpoints)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-notify:
+			}
+		}
+	}()
+}
@@ -0,0 +1,231 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ecommerce-go-api-gateway/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Probe statuses.
+const (
+	StatusUnknown = "unknown"
+	StatusUp      = "up"
+	StatusDown    = "down"
+)
+
+// Target is one dependency to probe. Optional targets are reported but do
+// not make the gateway unready when they are down. Targets sharing a Group
+// are the endpoints of one load balanced service, which stays ready while
+// any of them is up.
+type Target struct {
+	Name     string
+	URL      string
+	Group    string
+	Optional bool
+}
+
+// Result is the latest probe outcome for one target.
+type Result struct {
+	Status    string    `json:"status"`
+	Group     string    `json:"group,omitempty"`
+	Optional  bool      `json:"optional"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+// Checker probes every target in the background and keeps the latest
+// results, so readiness requests never wait on the upstreams.
+type Checker struct {
+	mu       sync.RWMutex
+	targets  []Target
+	client   *http.Client
+	interval time.Duration
+	results  map[string]Result
+
+	// retick tells the probe loop that the interval changed.
+	retick chan struct{}
+}
+
+func NewChecker(targets []Target, interval, timeout time.Duration) *Checker {
+	results := make(map[string]Result, len(targets))
+	for _, t := range targets {
+		results[t.Name] = Result{Status: StatusUnknown, Group: t.Group, Optional: t.Optional}
+	}
+	h := &Checker{targets: targets, results: results, retick: make(chan struct{}, 1)}
+	h.SetTiming(interval, timeout)
+	return h
+}
+
+// SetTiming changes how often targets are probed and how long one probe may
+// take. Zero values fall back to the defaults. A probe already running keeps
+// its old timeout.
+func (h *Checker) SetTiming(interval, timeout time.Duration) {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	h.mu.Lock()
+	changed := h.interval != 0 && h.interval != interval
+	h.interval = interval
+	h.client = &http.Client{Timeout: timeout}
+	h.mu.Unlock()
+
+	if changed {
+		select {
+		case h.retick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SetTargets replaces the probed targets. Results of targets that did not
+// change are kept; the others start over as unknown.
+func (h *Checker) SetTargets(targets []Target) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev := make(map[string]Target, len(h.targets))
+	for _, t := range h.targets {
+		prev[t.Name] = t
+	}
+	results := make(map[string]Result, len(targets))
+	for _, t := range targets {
+		if r, ok := h.results[t.Name]; ok && prev[t.Name] == t {
+			results[t.Name] = r
+			continue
+		}
+		results[t.Name] = Result{Status: StatusUnknown, Group: t.Group, Optional: t.Optional}
+	}
+	h.targets = targets
+	h.results = results
+}
+
+// Start probes all targets now and then every interval until ctx is done.
+func (h *Checker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(h.currentInterval())
+		defer ticker.Stop()
+		for {
+			h.probeAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.retick:
+				ticker.Reset(h.currentInterval())
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (h *Checker) currentInterval() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.interval
+}
+
+// Ready reports whether every non-optional target, or at least one target
+// of every non-optional group, was up at its last probe, along with the
+// per-target results.
+func (h *Checker) Ready() (bool, map[string]Result) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ready := true
+	groups := make(map[string]bool)
+	results := make(map[string]Result, len(h.results))
+	for name, r := range h.results {
+		results[name] = r
+		switch {
+		case r.Optional:
+		case r.Group != "":
+			groups[r.Group] = groups[r.Group] || r.Status == StatusUp
+		case r.Status != StatusUp:
+			ready = false
+		}
+	}
+	for _, up := range groups {
+		if !up {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+func (h *Checker) probeAll(ctx context.Context) {
+	h.mu.RLock()
+	targets, client := h.targets, h.client
+	h.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			h.record(t, probe(ctx, client, t))
+		}(t)
+	}
+	wg.Wait()
+}
+
+func probe(ctx context.Context, client *http.Client, t Target) Result {
+	res := Result{Status: StatusDown, Group: t.Group, Optional: t.Optional, CheckedAt: time.Now().UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	res.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		res.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		return res
+	}
+	res.Status = StatusUp
+	return res
+}
+
+func (h *Checker) record(t Target, res Result) {
+	h.mu.Lock()
+	prev, ok := h.results[t.Name]
+	if !ok {
+		// Removed by SetTargets while the probe was running
+		h.mu.Unlock()
+		return
+	}
+	h.results[t.Name] = res
+	h.mu.Unlock()
+
+	// A service coming up on the first probe is the normal case, not news
+	if prev.Status != res.Status && (prev.Status != StatusUnknown || res.Status != StatusUp) {
+		logger.Log.Warn("Upstream health changed",
+			zap.String("service", t.Name),
+			zap.String("from", prev.Status),
+			zap.String("to", res.Status),
+			zap.String("error", res.Error))
+	}
+}
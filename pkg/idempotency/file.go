@@ -0,0 +1,129 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileStore keeps one JSON file per key so records survive a restart. File
+// names are the SHA-256 of the key. Begin is atomic within one process.
+type fileStore struct {
+	dir       string
+	mu        sync.Mutex
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewFileStore(dir string) (Store, error) {
+	if dir == "" {
+		return nil, errors.New("idempotency dir is required for the file store")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create idempotency dir: %w", err)
+	}
+	return &fileStore{dir: dir, lastSweep: time.Now(), now: time.Now}, nil
+}
+
+func (s *fileStore) Begin(key, fingerprint string, lease time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	rec, err := s.read(key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+	if rec != nil && now.Before(rec.ExpiresAt) {
+		return rec, false, nil
+	}
+
+	err = s.write(key, &Record{Fingerprint: fingerprint, ExpiresAt: now.Add(lease)})
+	return nil, err == nil, err
+}
+
+func (s *fileStore) Complete(key string, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(key, rec)
+}
+
+func (s *fileStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// sweep deletes expired record files, at most once per sweepInterval.
+func (s *fileStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var rec Record
+		if json.Unmarshal(data, &rec) == nil && !now.Before(rec.ExpiresAt) {
+			os.Remove(p)
+		}
+	}
+}
+
+func (s *fileStore) read(key string) (*Record, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// write replaces the record through a temp file and rename.
+func (s *fileStore) write(key string, rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *fileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
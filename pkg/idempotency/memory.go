@@ -0,0 +1,62 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired records are purged from memory.
+const sweepInterval = time.Minute
+
+type memoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*Record
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{records: make(map[string]*Record), lastSweep: time.Now(), now: time.Now}
+}
+
+func (s *memoryStore) Begin(key, fingerprint string, lease time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if rec, ok := s.records[key]; ok && now.Before(rec.ExpiresAt) {
+		copied := *rec
+		return &copied, false, nil
+	}
+	s.records[key] = &Record{Fingerprint: fingerprint, ExpiresAt: now.Add(lease)}
+	return nil, true, nil
+}
+
+func (s *memoryStore) Complete(key string, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *rec
+	s.records[key] = &copied
+	return nil
+}
+
+func (s *memoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+	s.lastSweep = now
+}
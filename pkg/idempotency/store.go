@@ -0,0 +1,48 @@
+package idempotency
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+// Record is what is kept for one Idempotency-Key: the request fingerprint
+// and, once the first request finished, its response. ExpiresAt is the end
+// of the lease while the request is in progress and the end of the replay
+// TTL once it completed.
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	StatusCode  int         `json:"status_code,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+// Store keeps idempotency records. Implementations must make Begin atomic so
+// two concurrent requests with the same key cannot both claim it.
+type Store interface {
+	// Begin claims key for a new request, holding it in progress for lease.
+	// If the key is already claimed and its lease or TTL has not expired the
+	// existing record is returned with claimed=false; an expired claim is
+	// taken over.
+	Begin(key, fingerprint string, lease time.Duration) (rec *Record, claimed bool, err error)
+	// Complete stores the response of the request that claimed key.
+	Complete(key string, rec *Record) error
+	// Release drops key so the request can be retried.
+	Release(key string) error
+}
+
+// NewStore builds the store selected by cfg.Store ("memory" or "file").
+func NewStore(cfg config.IdempotencyConfig) (Store, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		return NewFileStore(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("unknown idempotency store %q", cfg.Store)
+	}
+}
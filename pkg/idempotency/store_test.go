@@ -0,0 +1,181 @@
+package idempotency
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// step is one store call at offset at from the start of the test clock.
+type step struct {
+	at          time.Duration
+	op          string // "begin", "complete" or "release"
+	fingerprint string
+	ttl         time.Duration // complete: how long the response is kept
+	wantClaimed bool
+	wantRecord  string // begin: fingerprint of the returned record
+	wantDone    bool   // begin: whether the returned record is completed
+}
+
+const lease = time.Minute
+
+// testStore returns a store of the given kind whose clock reads from *now.
+func testStore(t *testing.T, kind string) (Store, *time.Time) {
+	t.Helper()
+	now := time.Unix(1_000_000, 0)
+	clock := func() time.Time { return now }
+
+	if kind == "memory" {
+		s := NewMemoryStore().(*memoryStore)
+		s.now, s.lastSweep = clock, now
+		return s, &now
+	}
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.(*fileStore)
+	s.now, s.lastSweep = clock, now
+	return s, &now
+}
+
+var storeKinds = []string{"memory", "file"}
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "first request claims the key",
+			steps: []step{
+				{op: "begin", fingerprint: "a", wantClaimed: true},
+			},
+		},
+		{
+			name: "repeat while in progress",
+			steps: []step{
+				{op: "begin", fingerprint: "a", wantClaimed: true},
+				{at: 30 * time.Second, op: "begin", fingerprint: "a", wantRecord: "a"},
+				{at: 30 * time.Second, op: "begin", fingerprint: "b", wantRecord: "a"},
+			},
+		},
+		{
+			name: "expired lease is taken over",
+			steps: []step{
+				{op: "begin", fingerprint: "a", wantClaimed: true},
+				{at: lease - time.Second, op: "begin", fingerprint: "a", wantRecord: "a"},
+				{at: lease, op: "begin", fingerprint: "b", wantClaimed: true},
+				{at: lease + time.Second, op: "begin", fingerprint: "a", wantRecord: "b"},
+			},
+		},
+		{
+			name: "completed response is kept for its ttl",
+			steps: []step{
+				{op: "begin", fingerprint: "a", wantClaimed: true},
+				{at: time.Second, op: "complete", fingerprint: "a", ttl: time.Hour},
+				{at: lease + time.Second, op: "begin", fingerprint: "a", wantRecord: "a", wantDone: true},
+				{at: time.Hour, op: "begin", fingerprint: "a", wantRecord: "a", wantDone: true},
+				{at: time.Hour + time.Second, op: "begin", fingerprint: "a", wantClaimed: true},
+			},
+		},
+		{
+			name: "release frees the key",
+			steps: []step{
+				{op: "begin", fingerprint: "a", wantClaimed: true},
+				{at: time.Second, op: "release"},
+				{at: time.Second, op: "begin", fingerprint: "b", wantClaimed: true},
+			},
+		},
+		{
+			name: "release of an unknown key",
+			steps: []step{
+				{op: "release"},
+				{op: "begin", fingerprint: "a", wantClaimed: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, kind := range storeKinds {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				store, now := testStore(t, kind)
+				start := *now
+				for i, s := range tt.steps {
+					*now = start.Add(s.at)
+					switch s.op {
+					case "begin":
+						rec, claimed, err := store.Begin("key", s.fingerprint, lease)
+						if err != nil {
+							t.Fatalf("step %d: Begin() = %v", i, err)
+						}
+						if claimed != s.wantClaimed {
+							t.Fatalf("step %d: Begin() claimed = %v, want %v", i, claimed, s.wantClaimed)
+						}
+						if claimed {
+							if rec != nil {
+								t.Errorf("step %d: Begin() claimed with record %+v", i, rec)
+							}
+							continue
+						}
+						if rec.Fingerprint != s.wantRecord || rec.Completed != s.wantDone {
+							t.Errorf("step %d: Begin() = %s completed=%v, want %s completed=%v",
+								i, rec.Fingerprint, rec.Completed, s.wantRecord, s.wantDone)
+						}
+					case "complete":
+						err := store.Complete("key", &Record{Fingerprint: s.fingerprint, Completed: true, StatusCode: 201, ExpiresAt: now.Add(s.ttl)})
+						if err != nil {
+							t.Fatalf("step %d: Complete() = %v", i, err)
+						}
+					case "release":
+						if err := store.Release("key"); err != nil {
+							t.Fatalf("step %d: Release() = %v", i, err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStoreSweep(t *testing.T) {
+	for _, kind := range storeKinds {
+		t.Run(kind, func(t *testing.T) {
+			store, now := testStore(t, kind)
+			start := *now
+			for _, key := range []string{"done", "stuck"} {
+				if _, claimed, err := store.Begin(key, "a", lease); err != nil || !claimed {
+					t.Fatalf("Begin(%s) claimed = %v, %v", key, claimed, err)
+				}
+			}
+			store.Complete("done", &Record{Fingerprint: "a", Completed: true, ExpiresAt: start.Add(time.Second)})
+
+			// Expired records stay until the next sweep
+			*now = start.Add(sweepInterval - time.Second)
+			store.Begin("other", "a", time.Hour)
+			if got := storedKeys(t, store); got != 3 {
+				t.Fatalf("stored %d records before the sweep, want 3", got)
+			}
+
+			*now = start.Add(sweepInterval)
+			store.Begin("other", "a", time.Hour)
+			if got := storedKeys(t, store); got != 1 {
+				t.Errorf("stored %d records after the sweep, want 1", got)
+			}
+		})
+	}
+}
+
+func storedKeys(t *testing.T, store Store) int {
+	t.Helper()
+	switch s := store.(type) {
+	case *memoryStore:
+		return len(s.records)
+	case *fileStore:
+		paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(paths)
+	}
+	return 0
+}
@@ -0,0 +1,300 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+const (
+	defaultEjectionTime       = 30 * time.Second
+	defaultMaxEjectionPercent = 50
+
+	// ringPointsPerWeight is how many points each unit of weight places on
+	// the consistent hash ring.
+	ringPointsPerWeight = 100
+)
+
+// KeyFunc returns the key a request is hashed on by the consistent_hash
+// strategy, or "" to balance it round robin.
+type KeyFunc func(r *http.Request) string
+
+// Snapshot is a point-in-time view of a balancer, used by the admin endpoint.
+type Snapshot struct {
+	Name      string     `json:"name"`
+	Strategy  string     `json:"strategy"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Endpoint is the state of one endpoint in a Snapshot.
+type Endpoint struct {
+	URL          string     `json:"url"`
+	Weight       int        `json:"weight"`
+	Outstanding  int        `json:"outstanding"`
+	Failures     int        `json:"consecutive_failures"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+}
+
+type endpoint struct {
+	url    *url.URL
+	weight int
+
+	current      int // smooth weighted round robin state
+	outstanding  int
+	failures     int
+	ejectedUntil time.Time
+}
+
+type ringPoint struct {
+	hash     uint32
+	endpoint *endpoint
+}
+
+// Balancer is an http.RoundTripper that sends every request, retries
+// included, to one of a service's endpoints. Requests must be addressed to
+// any placeholder host; the scheme, host and path prefix of the chosen
+// endpoint replace it. Endpoints that keep failing are ejected for a while
+// (passive outlier detection).
+type Balancer struct {
+	name      string
+	strategy  string
+	outlier   config.OutlierConfig
+	key       KeyFunc
+	next      http.RoundTripper
+	endpoints []*endpoint
+	ring      []ringPoint
+
+	mu       sync.Mutex
+	ejected  int
+	rotation int
+
+	onEjection func(name, endpoint string, ejected bool)
+	now        func() time.Time
+}
+
+// New returns a balancer over cfg.Endpoints that sends requests on with
+// next. key may be nil when the strategy is not consistent_hash.
+func New(name string, cfg config.BalancerConfig, next http.RoundTripper, key KeyFunc) (*Balancer, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("%s has no endpoints", name)
+	}
+	if cfg.Strategy == "" {
+		cfg.Strategy = config.BalanceRoundRobin
+	}
+	if cfg.Outlier.EjectionTime <= 0 {
+		cfg.Outlier.EjectionTime = defaultEjectionTime
+	}
+	if cfg.Outlier.MaxEjectionPercent <= 0 {
+		cfg.Outlier.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+
+	b := &Balancer{name: name, strategy: cfg.Strategy, outlier: cfg.Outlier, key: key, next: next, now: time.Now}
+	for _, e := range cfg.Endpoints {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s endpoint %q: %w", name, e.URL, err)
+		}
+		weight := e.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		b.endpoints = append(b.endpoints, &endpoint{url: u, weight: weight})
+	}
+
+	if b.strategy == config.BalanceConsistentHash {
+		for _, e := range b.endpoints {
+			for i := 0; i < e.weight*ringPointsPerWeight; i++ {
+				hash := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", e.url, i)))
+				b.ring = append(b.ring, ringPoint{hash: hash, endpoint: e})
+			}
+		}
+		sort.Slice(b.ring, func(i, j int) bool { return b.ring[i].hash < b.ring[j].hash })
+	}
+	return b, nil
+}
+
+// OnEjection registers fn to be called (outside the lock) when an endpoint
+// is ejected or returns to the rotation.
+func (b *Balancer) OnEjection(fn func(name, endpoint string, ejected bool)) {
+	b.mu.Lock()
+	b.onEjection = fn
+	b.mu.Unlock()
+}
+
+func (b *Balancer) Name() string {
+	return b.name
+}
+
+func (b *Balancer) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	out := make([]Endpoint, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		s := Endpoint{URL: e.url.String(), Weight: e.weight, Outstanding: e.outstanding, Failures: e.failures}
+		if e.ejectedUntil.After(now) {
+			until := e.ejectedUntil
+			s.EjectedUntil = &until
+		}
+		out = append(out, s)
+	}
+	return Snapshot{Name: b.name, Strategy: b.strategy, Endpoints: out}
+}
+
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	e, returned := b.pick(req)
+	for _, r := range returned {
+		b.notify(r, false)
+	}
+
+	out := req.Clone(req.Context())
+	e.rewrite(out.URL)
+	out.Host = ""
+
+	resp, err := b.next.RoundTrip(out)
+
+	failed := (resp != nil && resp.StatusCode >= 500) || (err != nil && req.Context().Err() == nil)
+	if b.done(e, failed) {
+		b.notify(e, true)
+	}
+	return resp, err
+}
+
+// pick chooses the endpoint for req among those not ejected, or among all
+// when every one is. It also returns the endpoints whose ejection just ended.
+func (b *Balancer) pick(req *http.Request) (*endpoint, []*endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	var returned []*endpoint
+	available := make([]*endpoint, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if !e.ejectedUntil.IsZero() && !now.Before(e.ejectedUntil) {
+			e.ejectedUntil = time.Time{}
+			e.failures = 0
+			b.ejected--
+			returned = append(returned, e)
+		}
+		if e.ejectedUntil.IsZero() {
+			available = append(available, e)
+		}
+	}
+	if len(available) == 0 {
+		available = b.endpoints
+	}
+
+	var e *endpoint
+	switch {
+	case b.strategy == config.BalanceConsistentHash && b.key != nil:
+		if key := b.key(req); key != "" {
+			e = b.hashed(key, available)
+		}
+	case b.strategy == config.BalanceLeastOutstanding:
+		e = b.leastOutstanding(available)
+	}
+	if e == nil {
+		e = roundRobin(available)
+	}
+	e.outstanding++
+	return e, returned
+}
+
+// hashed walks the ring clockwise from key to the first available endpoint.
+func (b *Balancer) hashed(key string, available []*endpoint) *endpoint {
+	ok := make(map[*endpoint]bool, len(available))
+	for _, e := range available {
+		ok[e] = true
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= hash })
+	for i := 0; i < len(b.ring); i++ {
+		if p := b.ring[(start+i)%len(b.ring)]; ok[p.endpoint] {
+			return p.endpoint
+		}
+	}
+	return nil
+}
+
+// leastOutstanding picks the endpoint with the fewest requests in flight
+// per unit of weight. Ties go to the endpoints in turn.
+func (b *Balancer) leastOutstanding(available []*endpoint) *endpoint {
+	b.rotation++
+	var best *endpoint
+	for i := range available {
+		e := available[(b.rotation+i)%len(available)]
+		if best == nil || e.outstanding*best.weight < best.outstanding*e.weight {
+			best = e
+		}
+	}
+	return best
+}
+
+// roundRobin is nginx's smooth weighted round robin: over a cycle every
+// endpoint is picked weight times, interleaved rather than in runs.
+func roundRobin(available []*endpoint) *endpoint {
+	total := 0
+	var best *endpoint
+	for _, e := range available {
+		e.current += e.weight
+		total += e.weight
+		if best == nil || e.current > best.current {
+			best = e
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// done records the outcome of a request to e and reports whether it got e
+// ejected.
+func (b *Balancer) done(e *endpoint, failed bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.outstanding--
+	if !failed {
+		e.failures = 0
+		return false
+	}
+	e.failures++
+	if b.outlier.ConsecutiveFailures <= 0 || e.failures < b.outlier.ConsecutiveFailures || !e.ejectedUntil.IsZero() {
+		return false
+	}
+	maxEjected := max(int(float64(len(b.endpoints))*b.outlier.MaxEjectionPercent/100), 1)
+	if b.ejected >= maxEjected {
+		return false
+	}
+	e.ejectedUntil = b.now().Add(b.outlier.EjectionTime)
+	b.ejected++
+	return true
+}
+
+func (b *Balancer) notify(e *endpoint, ejected bool) {
+	b.mu.Lock()
+	fn := b.onEjection
+	b.mu.Unlock()
+	if fn != nil {
+		fn(b.name, e.url.String(), ejected)
+	}
+}
+
+// rewrite points u, addressed to the placeholder host, at the endpoint.
+func (e *endpoint) rewrite(u *url.URL) {
+	u.Scheme = e.url.Scheme
+	u.Host = e.url.Host
+	if prefix := strings.TrimSuffix(e.url.Path, "/"); prefix != "" {
+		if u.RawPath != "" {
+			u.RawPath = strings.TrimSuffix(e.url.EscapedPath(), "/") + u.RawPath
+		}
+		u.Path = prefix + u.Path
+	}
+}
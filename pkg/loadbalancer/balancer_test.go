@@ -0,0 +1,391 @@
+package loadbalancer
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+)
+
+// fakeUpstream answers every request with the status set for its host and
+// records which hosts were hit. Requests to a host with a gate block until
+// the gate is closed.
+type fakeUpstream struct {
+	mu     sync.Mutex
+	status map[string]int
+	gates  map[string]chan struct{}
+	hits   []string
+}
+
+func newFakeUpstream() *fakeUpstream {
+	return &fakeUpstream{status: map[string]int{}, gates: map[string]chan struct{}{}}
+}
+
+func (u *fakeUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.mu.Lock()
+	u.hits = append(u.hits, req.URL.Host)
+	status, gate := u.status[req.URL.Host], u.gates[req.URL.Host]
+	u.mu.Unlock()
+
+	if gate != nil {
+		<-gate
+	}
+	rec := httptest.NewRecorder()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	rec.WriteHeader(status)
+	return rec.Result(), nil
+}
+
+func (u *fakeUpstream) setStatus(host string, status int) {
+	u.mu.Lock()
+	u.status[host] = status
+	u.mu.Unlock()
+}
+
+// take returns the hosts hit since the last call.
+func (u *fakeUpstream) take() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	hits := u.hits
+	u.hits = nil
+	return hits
+}
+
+func endpoints(hosts ...string) []config.EndpointConfig {
+	out := make([]config.EndpointConfig, len(hosts))
+	for i, h := range hosts {
+		name, weight, _ := strings.Cut(h, "*")
+		out[i] = config.EndpointConfig{URL: "http://" + name}
+		if weight != "" {
+			out[i].Weight = int(weight[0] - '0')
+		}
+	}
+	return out
+}
+
+func newTestBalancer(t *testing.T, cfg config.BalancerConfig, key KeyFunc) (*Balancer, *fakeUpstream, *time.Time) {
+	t.Helper()
+	up := newFakeUpstream()
+	b, err := New("test", cfg, up, key)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+	return b, up, &now
+}
+
+func send(t *testing.T, b *Balancer, user string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://service/products", nil)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	resp, err := b.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() = %v", err)
+	}
+	resp.Body.Close()
+}
+
+func userKey(r *http.Request) string {
+	return r.Header.Get("X-User")
+}
+
+func count(hits []string) map[string]int {
+	out := map[string]int{}
+	for _, h := range hits {
+		out[h]++
+	}
+	return out
+}
+
+func TestRoundRobin(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints []config.EndpointConfig
+		want      []string
+	}{
+		{name: "equal weights", endpoints: endpoints("a", "b", "c"), want: []string{"a", "b", "c", "a", "b", "c"}},
+		{name: "weights interleave", endpoints: endpoints("a*5", "b", "c"), want: []string{"a", "a", "b", "a", "c", "a", "a"}},
+		{name: "two to one", endpoints: endpoints("a*2", "b"), want: []string{"a", "b", "a", "a", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, up, _ := newTestBalancer(t, config.BalancerConfig{Endpoints: tt.endpoints}, nil)
+			for range tt.want {
+				send(t, b, "")
+			}
+			if got := up.take(); !slices.Equal(got, tt.want) {
+				t.Errorf("hits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundRobinDistribution(t *testing.T) {
+	b, up, _ := newTestBalancer(t, config.BalancerConfig{Endpoints: endpoints("a*3", "b*2", "c")}, nil)
+	for i := 0; i < 600; i++ {
+		send(t, b, "")
+	}
+	want := map[string]int{"a": 300, "b": 200, "c": 100}
+	if got := count(up.take()); !maps.Equal(got, want) {
+		t.Errorf("hits = %v, want %v", got, want)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	cfg := config.BalancerConfig{Strategy: config.BalanceLeastOutstanding, Endpoints: endpoints("a", "b", "c")}
+
+	t.Run("ties rotate", func(t *testing.T) {
+		b, up, _ := newTestBalancer(t, cfg, nil)
+		for i := 0; i < 6; i++ {
+			send(t, b, "")
+		}
+		hits := up.take()
+		if want := map[string]int{"a": 2, "b": 2, "c": 2}; !maps.Equal(count(hits), want) {
+			t.Errorf("hits = %v, want every endpoint twice", hits)
+		}
+		for i := 1; i < len(hits); i++ {
+			if hits[i] == hits[i-1] {
+				t.Errorf("hits = %v, want no endpoint twice in a row", hits)
+			}
+		}
+	})
+
+	t.Run("avoids busy endpoint", func(t *testing.T) {
+		b, up, _ := newTestBalancer(t, cfg, nil)
+		gate := make(chan struct{})
+		up.gates["a"] = gate
+
+		// Send until a request is stuck at a
+		var wg sync.WaitGroup
+		for b.Snapshot().Endpoints[0].Outstanding == 0 {
+			done := make(chan struct{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer close(done)
+				req := httptest.NewRequest(http.MethodGet, "http://service/products", nil)
+				if resp, err := b.RoundTrip(req); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			waitFor(func() bool {
+				select {
+				case <-done:
+					return true
+				default:
+					return b.Snapshot().Endpoints[0].Outstanding == 1
+				}
+			})
+		}
+		up.take()
+
+		for i := 0; i < 6; i++ {
+			send(t, b, "")
+		}
+		if hits := up.take(); slices.Contains(hits, "a") {
+			t.Errorf("hits = %v, want none at the busy endpoint", hits)
+		}
+		close(gate)
+		wg.Wait()
+	})
+}
+
+func TestConsistentHash(t *testing.T) {
+	cfg := config.BalancerConfig{
+		Strategy:  config.BalanceConsistentHash,
+		Endpoints: endpoints("a", "b", "c"),
+		Outlier:   config.OutlierConfig{ConsecutiveFailures: 1, EjectionTime: time.Minute, MaxEjectionPercent: 100},
+	}
+	b, up, _ := newTestBalancer(t, cfg, userKey)
+
+	for i := 0; i < 10; i++ {
+		send(t, b, "7")
+	}
+	hits := count(up.take())
+	if len(hits) != 1 {
+		t.Fatalf("hits = %v, want one endpoint for one user", hits)
+	}
+	var home string
+	for h := range hits {
+		home = h
+	}
+
+	users := map[string]bool{}
+	for i := 0; i < 30; i++ {
+		send(t, b, string(rune('a'+i)))
+	}
+	for _, h := range up.take() {
+		users[h] = true
+	}
+	if len(users) < 2 {
+		t.Errorf("30 users all hashed to %v, want them spread", users)
+	}
+
+	up.setStatus(home, http.StatusBadGateway)
+	send(t, b, "7")
+	up.take()
+
+	for i := 0; i < 10; i++ {
+		send(t, b, "7")
+	}
+	hits = count(up.take())
+	if len(hits) != 1 || hits[home] != 0 {
+		t.Errorf("hits = %v, want one endpoint other than the ejected %s", hits, home)
+	}
+}
+
+func TestEjectionCap(t *testing.T) {
+	tests := []struct {
+		name        string
+		hosts       []string
+		maxPercent  float64
+		wantEjected int
+	}{
+		{name: "half of four", hosts: []string{"a", "b", "c", "d"}, maxPercent: 50, wantEjected: 2},
+		{name: "rounds down", hosts: []string{"a", "b", "c"}, maxPercent: 50, wantEjected: 1},
+		{name: "at least one", hosts: []string{"a", "b", "c"}, maxPercent: 10, wantEjected: 1},
+		{name: "all", hosts: []string{"a", "b"}, maxPercent: 100, wantEjected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.BalancerConfig{
+				Endpoints: endpoints(tt.hosts...),
+				Outlier:   config.OutlierConfig{ConsecutiveFailures: 2, EjectionTime: time.Minute, MaxEjectionPercent: tt.maxPercent},
+			}
+			b, up, _ := newTestBalancer(t, cfg, nil)
+			for _, h := range tt.hosts {
+				up.setStatus(h, http.StatusServiceUnavailable)
+			}
+			var ejections int
+			b.OnEjection(func(_, _ string, ejected bool) {
+				if ejected {
+					ejections++
+				}
+			})
+
+			for i := 0; i < 10*len(tt.hosts); i++ {
+				send(t, b, "")
+			}
+
+			ejected := 0
+			for _, e := range b.Snapshot().Endpoints {
+				if e.EjectedUntil != nil {
+					ejected++
+				}
+			}
+			if ejected != tt.wantEjected || ejections != tt.wantEjected {
+				t.Errorf("ejected = %d (%d notified), want %d", ejected, ejections, tt.wantEjected)
+			}
+		})
+	}
+}
+
+func TestEjectedEndpointReturns(t *testing.T) {
+	cfg := config.BalancerConfig{
+		Endpoints: endpoints("a", "b"),
+		Outlier:   config.OutlierConfig{ConsecutiveFailures: 1, EjectionTime: 30 * time.Second, MaxEjectionPercent: 50},
+	}
+	b, up, now := newTestBalancer(t, cfg, nil)
+	var events []string
+	b.OnEjection(func(_, endpoint string, ejected bool) {
+		if ejected {
+			events = append(events, "eject "+endpoint)
+		} else {
+			events = append(events, "return "+endpoint)
+		}
+	})
+
+	up.setStatus("a", http.StatusInternalServerError)
+	send(t, b, "")
+	up.setStatus("a", http.StatusOK)
+	up.take()
+
+	for i := 0; i < 4; i++ {
+		send(t, b, "")
+	}
+	if hits := up.take(); slices.Contains(hits, "a") {
+		t.Errorf("hits while ejected = %v, want only b", hits)
+	}
+
+	*now = now.Add(29 * time.Second)
+	send(t, b, "")
+	if hits := up.take(); slices.Contains(hits, "a") {
+		t.Errorf("hits before ejection_time = %v, want only b", hits)
+	}
+
+	*now = now.Add(time.Second)
+	for i := 0; i < 4; i++ {
+		send(t, b, "")
+	}
+	if hits := count(up.take()); hits["a"] != 2 || hits["b"] != 2 {
+		t.Errorf("hits after ejection_time = %v, want a back in rotation", hits)
+	}
+	if want := []string{"eject http://a", "return http://a"}; !slices.Equal(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	if snap := b.Snapshot().Endpoints[0]; snap.EjectedUntil != nil || snap.Failures != 0 {
+		t.Errorf("a = %+v, want no ejection and no failures", snap)
+	}
+}
+
+func TestCanceledRequestIsNotAFailure(t *testing.T) {
+	cfg := config.BalancerConfig{
+		Endpoints: endpoints("a"),
+		Outlier:   config.OutlierConfig{ConsecutiveFailures: 1},
+	}
+	b, _, _ := newTestBalancer(t, cfg, nil)
+	b.next = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, context.Canceled
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "http://service/products", nil).WithContext(ctx)
+	if _, err := b.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() = nil error, want the transport error")
+	}
+	if snap := b.Snapshot().Endpoints[0]; snap.Failures != 0 || snap.Outstanding != 0 {
+		t.Errorf("a = %+v, want no failure and nothing outstanding", snap)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	b, up, _ := newTestBalancer(t, config.BalancerConfig{Endpoints: []config.EndpointConfig{{URL: "https://api.internal/v2/"}}}, nil)
+	var got string
+	b.next = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		got = r.URL.String()
+		return up.RoundTrip(r)
+	})
+	send(t, b, "")
+	if want := "https://api.internal/v2/products"; got != want {
+		t.Errorf("URL = %s, want %s", got, want)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
@@ -7,9 +7,12 @@ import (
 
 var Log *zap.Logger
 
-func InitLogger(level string) {
+// level is shared by Log so SetLevel can change it at runtime.
+var level = zap.NewAtomicLevel()
+
+func InitLogger(lvl string) {
 	var config zap.Config
-	if level == "debug" {
+	if lvl == "debug" {
 		config = zap.NewDevelopmentConfig()
 	} else {
 		config = zap.NewProductionConfig()
@@ -18,9 +21,25 @@ func InitLogger(level string) {
 	// Set timestamp format
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
+	// Unknown levels keep the config's default; validation reports them
+	level.SetLevel(config.Level.Level())
+	SetLevel(lvl)
+	config.Level = level
+
 	var err error
 	Log, err = config.Build()
 	if err != nil {
 		panic(err)
 	}
 }
+
+// SetLevel changes the minimum level of Log, e.g. "debug" or "warn". The
+// encoder chosen at startup stays the same.
+func SetLevel(lvl string) error {
+	l, err := zapcore.ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gateway"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route template and status class.",
+	}, []string{"method", "route", "status_class"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by route template and status class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status_class"})
+
+	httpInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served, by route template.",
+	}, []string{"method", "route"})
+
+	upstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Calls to upstream services, by operation and outcome (status class or error).",
+	}, []string{"service", "operation", "outcome"})
+
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Upstream call latency including retries, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "operation"})
+
+	upstreamInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_in_flight",
+		Help:      "Upstream calls currently in progress, by service.",
+	}, []string{"service"})
+
+	upstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_retries_total",
+		Help:      "Retries made by upstream calls, by operation.",
+	}, []string{"service", "operation"})
+
+	upstreamCoalesced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_coalesced_total",
+		Help:      "Upstream reads that joined an identical call already in flight instead of being sent.",
+	}, []string{"service", "operation"})
+
+	breakerRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_rejections_total",
+		Help:      "Upstream calls rejected by an open circuit breaker, by operation.",
+	}, []string{"service", "operation"})
+
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state per service: 0 closed, 1 open, 2 half-open.",
+	}, []string{"service"})
+
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Circuit breaker state changes per service.",
+	}, []string{"service", "from", "to"})
+
+	endpointEjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_endpoint_ejections_total",
+		Help:      "Endpoints ejected from load balancing by outlier detection.",
+	}, []string{"service", "endpoint"})
+
+	endpointEjected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_endpoint_ejected",
+		Help:      "Whether an endpoint is currently ejected from load balancing: 1 ejected, 0 in rotation.",
+	}, []string{"service", "endpoint"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Response cache lookups per route and result: hit, stale, stale_if_error or miss.",
+	}, []string{"route", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, httpInFlight,
+		upstreamRequests, upstreamDuration, upstreamInFlight, upstreamRetries, upstreamCoalesced,
+		breakerRejections, breakerState, breakerTransitions,
+		endpointEjections, endpointEjected,
+		cacheLookups,
+	)
+}
+
+// Handler serves the gateway metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// HTTPRequestStarted marks a request on route as in flight. The returned
+// func records its outcome and must be called once it is done.
+func HTTPRequestStarted(method, route string) func(status int) {
+	start := time.Now()
+	inFlight := httpInFlight.WithLabelValues(method, route)
+	inFlight.Inc()
+
+	return func(status int) {
+		inFlight.Dec()
+		class := StatusClass(status)
+		httpRequests.WithLabelValues(method, route, class).Inc()
+		httpDuration.WithLabelValues(method, route, class).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UpstreamStarted marks a call to service as in flight. The returned func
+// records its outcome ("2xx".."5xx" or "error") and retry count.
+func UpstreamStarted(service, operation string) func(outcome string, retries int) {
+	start := time.Now()
+	inFlight := upstreamInFlight.WithLabelValues(service)
+	inFlight.Inc()
+
+	return func(outcome string, retries int) {
+		inFlight.Dec()
+		upstreamRequests.WithLabelValues(service, operation, outcome).Inc()
+		upstreamDuration.WithLabelValues(service, operation).Observe(time.Since(start).Seconds())
+		if retries > 0 {
+			upstreamRetries.WithLabelValues(service, operation).Add(float64(retries))
+		}
+	}
+}
+
+// UpstreamCoalesced counts a call to service that joined an identical one
+// in flight.
+func UpstreamCoalesced(service, operation string) {
+	upstreamCoalesced.WithLabelValues(service, operation).Inc()
+}
+
+// BreakerRejected counts a call rejected by service's open circuit breaker.
+func BreakerRejected(service, operation string) {
+	breakerRejections.WithLabelValues(service, operation).Inc()
+}
+
+// SetBreakerState records the current breaker state of service.
+func SetBreakerState(service string, state int) {
+	breakerState.WithLabelValues(service).Set(float64(state))
+}
+
+// BreakerTransition counts a breaker state change of service.
+func BreakerTransition(service, from, to string) {
+	breakerTransitions.WithLabelValues(service, from, to).Inc()
+}
+
+// SetEndpointEjected records whether an endpoint of service is ejected,
+// counting each ejection.
+func SetEndpointEjected(service, endpoint string, ejected bool) {
+	if ejected {
+		endpointEjections.WithLabelValues(service, endpoint).Inc()
+		endpointEjected.WithLabelValues(service, endpoint).Set(1)
+		return
+	}
+	endpointEjected.WithLabelValues(service, endpoint).Set(0)
+}
+
+// CacheLookup counts a response cache lookup on route.
+func CacheLookup(route, result string) {
+	cacheLookups.WithLabelValues(route, result).Inc()
+}
+
+// StatusClass buckets an HTTP status code as "2xx", "4xx", etc.
+func StatusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
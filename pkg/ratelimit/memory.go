@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle keys are purged from memory.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely.
+	full time.Time
+}
+
+// window tracks a sliding window as the counts of the current and previous
+// fixed windows; the previous count is weighted by how much of it still
+// overlaps the sliding window.
+type window struct {
+	start time.Time
+	size  time.Duration
+	prev  int
+	curr  int
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets:   make(map[string]*bucket),
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (s *memoryStore) TokenBucket(key string, capacity int, rate float64) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(capacity), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(capacity), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(capacity) - b.tokens) / rate)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+func (s *memoryStore) SlidingWindow(key string, limit int, size time.Duration) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	start := now.Truncate(size)
+	w, ok := s.windows[key]
+	switch {
+	case !ok || w.size != size:
+		w = &window{start: start, size: size}
+		s.windows[key] = w
+	case start.Sub(w.start) == size:
+		w.prev, w.curr, w.start = w.curr, 0, start
+	case start.After(w.start):
+		w.prev, w.curr, w.start = 0, 0, start
+	}
+
+	elapsed := now.Sub(w.start)
+	weight := 1 - float64(elapsed)/float64(size)
+	count := float64(w.prev)*weight + float64(w.curr)
+
+	res := Result{Limit: limit}
+	if count+1 <= float64(limit) {
+		w.curr++
+		count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = w.retryAfter(limit, elapsed)
+	}
+	res.Remaining = max(limit-int(math.Ceil(count)), 0)
+
+	// The count drains to zero once neither fixed window overlaps any more
+	res.Reset = size - elapsed
+	if w.curr > 0 {
+		res.Reset += size
+	}
+	return res, nil
+}
+
+// retryAfter is how long until the weighted count leaves room for one more
+// request.
+func (w *window) retryAfter(limit int, elapsed time.Duration) time.Duration {
+	room := float64(limit - 1)
+	if w.curr <= limit-1 && w.prev > 0 {
+		// Still within this window, once enough of prev has slid out
+		at := 1 - (room-float64(w.curr))/float64(w.prev)
+		return time.Duration(at*float64(w.size)) - elapsed
+	}
+	// Next window, once enough of the current count has slid out
+	at := 1 - room/float64(w.curr)
+	return w.size - elapsed + time.Duration(at*float64(w.size))
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, w := range s.windows {
+		if now.Sub(w.start) >= 2*w.size {
+			delete(s.windows, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
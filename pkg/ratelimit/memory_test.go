@@ -0,0 +1,236 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// check is one request at offset at from the start of the test clock.
+type check struct {
+	at         time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+// testStore returns a memory store whose clock reads from *now. The start is
+// aligned to every window size used below.
+func testStore() (*memoryStore, *time.Time) {
+	s := NewMemoryStore().(*memoryStore)
+	now := time.Unix(1_000_000, 0)
+	s.now = func() time.Time { return now }
+	s.lastSweep = now
+	return s, &now
+}
+
+// near allows for float rounding in the duration math.
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d > -time.Millisecond && d < time.Millisecond
+}
+
+func runChecks(t *testing.T, checks []check, do func() (Result, error), now *time.Time) {
+	t.Helper()
+	start := *now
+	for i, c := range checks {
+		*now = start.Add(c.at)
+		res, err := do()
+		if err != nil {
+			t.Fatalf("check %d at %v: %v", i, c.at, err)
+		}
+		if res.Allowed != c.allowed || res.Remaining != c.remaining || !near(res.RetryAfter, c.retryAfter) {
+			t.Errorf("check %d at %v: got allowed=%v remaining=%d retry_after=%v, want allowed=%v remaining=%d retry_after=%v",
+				i, c.at, res.Allowed, res.Remaining, res.RetryAfter, c.allowed, c.remaining, c.retryAfter)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		rate     float64
+		checks   []check
+	}{
+		{
+			name:     "burst then refill",
+			capacity: 3,
+			rate:     1,
+			checks: []check{
+				{at: 0, allowed: true, remaining: 2},
+				{at: 0, allowed: true, remaining: 1},
+				{at: 0, allowed: true, remaining: 0},
+				{at: 0, allowed: false, remaining: 0, retryAfter: time.Second},
+				{at: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+				{at: time.Second, allowed: true, remaining: 0},
+				{at: 3500 * time.Millisecond, allowed: true, remaining: 1},
+			},
+		},
+		{
+			name:     "refill stops at capacity",
+			capacity: 2,
+			rate:     1,
+			checks: []check{
+				{at: 0, allowed: true, remaining: 1},
+				{at: time.Hour, allowed: true, remaining: 1},
+				{at: time.Hour, allowed: true, remaining: 0},
+				{at: time.Hour, allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+		{
+			name:     "slow rate",
+			capacity: 2,
+			rate:     0.5,
+			checks: []check{
+				{at: 0, allowed: true, remaining: 1},
+				{at: 0, allowed: true, remaining: 0},
+				{at: 0, allowed: false, remaining: 0, retryAfter: 2 * time.Second},
+				{at: 1500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+				{at: 2 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:     "limit of one",
+			capacity: 1,
+			rate:     1.0 / 60,
+			checks: []check{
+				{at: 0, allowed: true, remaining: 0},
+				{at: 0, allowed: false, remaining: 0, retryAfter: time.Minute},
+				{at: 45 * time.Second, allowed: false, remaining: 0, retryAfter: 15 * time.Second},
+				{at: time.Minute, allowed: true, remaining: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, now := testStore()
+			runChecks(t, tt.checks, func() (Result, error) {
+				return s.TokenBucket("k", tt.capacity, tt.rate)
+			}, now)
+		})
+	}
+}
+
+func TestTokenBucketReset(t *testing.T) {
+	s, _ := testStore()
+	s.TokenBucket("k", 4, 2)
+	res, _ := s.TokenBucket("k", 4, 2)
+	if res.Limit != 4 || !near(res.Reset, time.Second) {
+		t.Errorf("limit=%d reset=%v, want 4 and 1s for two tokens at 2/s", res.Limit, res.Reset)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	const size = 10 * time.Second
+	tests := []struct {
+		name   string
+		limit  int
+		checks []check
+	}{
+		{
+			name:  "full window waits for the count to slide out",
+			limit: 5,
+			checks: []check{
+				{at: 0, allowed: true, remaining: 4},
+				{at: 0, allowed: true, remaining: 3},
+				{at: 0, allowed: true, remaining: 2},
+				{at: 0, allowed: true, remaining: 1},
+				{at: 0, allowed: true, remaining: 0},
+				// 5 requests in this window: room for one more once 1/5 of
+				// them slid out, 2s into the next window
+				{at: 0, allowed: false, remaining: 0, retryAfter: 12 * time.Second},
+				{at: 11900 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 100 * time.Millisecond},
+				{at: 12 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "previous window is weighted by its overlap",
+			limit: 5,
+			checks: []check{
+				{at: 2 * time.Second, allowed: true, remaining: 4},
+				{at: 2 * time.Second, allowed: true, remaining: 3},
+				{at: 2 * time.Second, allowed: true, remaining: 2},
+				{at: 2 * time.Second, allowed: true, remaining: 1},
+				{at: 2 * time.Second, allowed: true, remaining: 0},
+				// 5 * 0.8 of the previous window counts
+				{at: 12 * time.Second, allowed: true, remaining: 0},
+				// 4 + 1 + 1 > 5: wait until 5 * w + 1 + 1 <= 5, w = 0.6
+				{at: 12 * time.Second, allowed: false, remaining: 0, retryAfter: 2 * time.Second},
+				{at: 14 * time.Second, allowed: true, remaining: 0},
+				// 5 * 0.5 + 2 + 1 > 5: wait until w = 0.4
+				{at: 15 * time.Second, allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+		{
+			name:  "rollover past an idle window forgets both",
+			limit: 2,
+			checks: []check{
+				{at: 0, allowed: true, remaining: 1},
+				{at: 0, allowed: true, remaining: 0},
+				{at: 25 * time.Second, allowed: true, remaining: 1},
+				{at: 25 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "limit of one in the same window",
+			limit: 1,
+			checks: []check{
+				{at: 3 * time.Second, allowed: true, remaining: 0},
+				// Must wait for the whole next window to pass
+				{at: 4 * time.Second, allowed: false, remaining: 0, retryAfter: 16 * time.Second},
+				{at: 19900 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 100 * time.Millisecond},
+				{at: 20 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "limit of one after rollover",
+			limit: 1,
+			checks: []check{
+				{at: 3 * time.Second, allowed: true, remaining: 0},
+				// prev = 1 at weight 0.5: wait until it slid out completely
+				{at: 15 * time.Second, allowed: false, remaining: 0, retryAfter: 5 * time.Second},
+				{at: 20 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, now := testStore()
+			runChecks(t, tt.checks, func() (Result, error) {
+				return s.SlidingWindow("k", tt.limit, size)
+			}, now)
+		})
+	}
+}
+
+func TestSlidingWindowReset(t *testing.T) {
+	s, now := testStore()
+	*now = now.Add(4 * time.Second)
+	res, _ := s.SlidingWindow("k", 3, 10*time.Second)
+	// The request counts in this window and, weighted, in the next
+	if !near(res.Reset, 16*time.Second) {
+		t.Errorf("reset = %v, want 16s", res.Reset)
+	}
+}
+
+func TestSweepDropsIdleKeys(t *testing.T) {
+	s, now := testStore()
+	s.TokenBucket("bucket", 2, 1)
+	s.SlidingWindow("window", 2, 40*time.Second)
+
+	*now = now.Add(sweepInterval)
+	s.TokenBucket("other", 2, 1)
+
+	if _, ok := s.buckets["bucket"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := s.windows["window"]; !ok {
+		t.Error("window was swept before two window sizes passed")
+	}
+
+	*now = now.Add(sweepInterval)
+	s.TokenBucket("other", 2, 1)
+	if _, ok := s.windows["window"]; ok {
+		t.Error("idle window was not swept")
+	}
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Result is the outcome of one rate limit check.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the limit is fully replenished.
+	Reset time.Duration
+	// RetryAfter is how long a rejected client should wait before retrying.
+	RetryAfter time.Duration
+}
+
+// Store counts requests per key. The memory store is local to one gateway
+// instance; a shared backend (e.g. Redis) implements the same interface so
+// several instances enforce a single limit. Both methods consume one request
+// when it is allowed and must be atomic per key.
+type Store interface {
+	// TokenBucket allows bursts of up to capacity requests, refilled at rate
+	// tokens per second.
+	TokenBucket(key string, capacity int, rate float64) (Result, error)
+	// SlidingWindow allows limit requests in any window-long period.
+	SlidingWindow(key string, limit int, window time.Duration) (Result, error)
+}
+
+// NewStore builds the store selected by name. Only "memory" is built in;
+// other backends are passed to the middleware directly.
+func NewStore(name string) (Store, error) {
+	switch name {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", name)
+	}
+}
@@ -0,0 +1,19 @@
+package requestid
+
+import "context"
+
+// Header correlates a request across the gateway and upstreams.
+const Header = "X-Request-ID"
+
+type ctxKey struct{}
+
+// NewContext attaches id to ctx so it is logged and sent upstream.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the ID set by NewContext.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
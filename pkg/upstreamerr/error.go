@@ -0,0 +1,22 @@
+package upstreamerr
+
+import "fmt"
+
+// Error is returned when a backend service answers with a non-2xx status.
+// Message and Code are taken from the response body when it is JSON.
+type Error struct {
+	Service    string
+	StatusCode int
+	Code       string
+	Message    string
+	Body       []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s error (status %d): %s", e.Service, e.StatusCode, e.Message)
+}
+
+// IsClientError reports whether the upstream rejected the request itself (4xx).
+func (e *Error) IsClientError() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Conditional requests are answered from validators the gateway computes:
+// the ETag is a strong tag over the JSON encoding of the data (not the
+// envelope, which carries the request ID), and Last-Modified is when this
+// gateway first served that representation, since the upstream models carry
+// no modification time. After a restart the times start over, which only
+// makes If-Modified-Since miss.
+var firstServed = cache.NewMemoryStore(8 << 20)
+
+const firstServedTTL = 7 * 24 * time.Hour
+
+// ETag returns a strong entity tag for data.
+func ETag(data interface{}) string {
+	body, _ := json.Marshal(data)
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// SendConditional is SendSuccess for reads with a 200 status. It sets ETag
+// and Last-Modified, and answers 304 Not Modified without a body when the
+// request's If-None-Match or, failing that, If-Modified-Since shows the
+// client already has data.
+func SendConditional(c *gin.Context, message string, data interface{}) {
+	sendConditional(c, message, data, nil)
+}
+
+// SendConditionalPage is SendConditional for one page of a listing, with
+// its pagination metadata.
+func SendConditionalPage(c *gin.Context, message string, data interface{}, page models.Pagination) {
+	sendConditional(c, message, data, &page)
+}
+
+func sendConditional(c *gin.Context, message string, data interface{}, page *models.Pagination) {
+	etag := ETag(data)
+	if page != nil {
+		etag = ETag([]interface{}{data, page})
+	}
+	modified := lastModified(c.Request.URL.RequestURI(), etag)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	if notModified(c.Request, etag, modified) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Success:    true,
+		Message:    message,
+		Data:       data,
+		Pagination: page,
+		RequestID:  requestID(c),
+	})
+}
+
+// CheckIfMatch enforces the request's If-Match header against current, the
+// resource as it is now. When it does not match, CheckIfMatch answers 412
+// Precondition Failed and returns false. Requests without If-Match pass.
+func CheckIfMatch(c *gin.Context, current interface{}) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || matchesETag(header, ETag(current), false) {
+		return true
+	}
+	SendError(c, http.StatusPreconditionFailed, "Precondition failed", "the resource has changed since it was read")
+	return false
+}
+
+func lastModified(resource, etag string) time.Time {
+	key := resource + "|" + etag
+	if e, ok, _ := firstServed.Get(key); ok {
+		return e.StoredAt
+	}
+	now := time.Now().Truncate(time.Second)
+	_ = firstServed.Set(key, cache.Entry{StoredAt: now}, firstServedTTL)
+	return now
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when it is
+// absent, as RFC 9110 orders them.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return matchesETag(header, etag, true)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.After(since)
+}
+
+// matchesETag reports whether etag is one of the tags listed in header, or
+// header is "*". The weak comparison ignores W/ prefixes; the strong one
+// never matches a weak tag.
+func matchesETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MergePatchContentType is the media type of JSON Merge Patch (RFC 7386)
+// documents. Plain application/json is accepted for PATCH as well.
+const MergePatchContentType = "application/merge-patch+json"
+
+// BindMergePatch applies the request body, a JSON Merge Patch, to obj,
+// which must point to the current resource in its request model, and
+// validates the result like ShouldBindJSON would. Members set to null are
+// reset to their zero value. On failure it answers the request and returns
+// false.
+func BindMergePatch(c *gin.Context, obj interface{}) bool {
+	if ct := c.ContentType(); ct != MergePatchContentType && ct != binding.MIMEJSON {
+		SendError(c, http.StatusUnsupportedMediaType, "Unsupported media type", "expected "+MergePatchContentType)
+		return false
+	}
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		SendBindError(c, err)
+		return false
+	}
+	current, err := json.Marshal(obj)
+	if err != nil {
+		SendError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return false
+	}
+	merged, err := mergePatch(current, patch)
+	if err != nil {
+		SendBindError(c, err)
+		return false
+	}
+
+	reflect.ValueOf(obj).Elem().SetZero()
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		SendBindError(c, err)
+		return false
+	}
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		SendBindError(c, err)
+		return false
+	}
+	return true
+}
+
+func mergePatch(target, patch []byte) ([]byte, error) {
+	var t, p interface{}
+	if err := json.Unmarshal(target, &t); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(t, p))
+}
+
+// mergeValue is the MergePatch function of RFC 7386, section 2.
+func mergeValue(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergeValue(t[k], v)
+	}
+	return t
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMergePatch runs the examples of RFC 7386, Appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" + "+tt.patch, func(t *testing.T) {
+			got, err := mergePatch([]byte(tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("mergePatch() = %v", err)
+			}
+			var gotValue, wantValue interface{}
+			json.Unmarshal(got, &gotValue)
+			json.Unmarshal([]byte(tt.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("mergePatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type patchDimensions struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type patchTarget struct {
+	Name       string           `json:"name" binding:"required"`
+	Price      float64          `json:"price" binding:"gte=0"`
+	Tags       []string         `json:"tags,omitempty"`
+	Dimensions *patchDimensions `json:"dimensions,omitempty"`
+}
+
+func TestBindMergePatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	current := func() patchTarget {
+		return patchTarget{Name: "Lamp", Price: 20, Tags: []string{"home"}, Dimensions: &patchDimensions{Width: 10, Height: 30}}
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		want        patchTarget
+		wantStatus  int
+		wantCode    string
+	}{
+		{
+			name:  "replaces members",
+			patch: `{"price":25}`,
+			want:  patchTarget{Name: "Lamp", Price: 25, Tags: []string{"home"}, Dimensions: &patchDimensions{Width: 10, Height: 30}},
+		},
+		{
+			name:  "null deletes a member",
+			patch: `{"tags":null}`,
+			want:  patchTarget{Name: "Lamp", Price: 20, Dimensions: &patchDimensions{Width: 10, Height: 30}},
+		},
+		{
+			name:  "merges nested objects",
+			patch: `{"dimensions":{"height":null,"width":12}}`,
+			want:  patchTarget{Name: "Lamp", Price: 20, Tags: []string{"home"}, Dimensions: &patchDimensions{Width: 12}},
+		},
+		{
+			name:  "arrays are replaced",
+			patch: `{"tags":["office"]}`,
+			want:  patchTarget{Name: "Lamp", Price: 20, Tags: []string{"office"}, Dimensions: &patchDimensions{Width: 10, Height: 30}},
+		},
+		{
+			name:        "plain JSON is accepted",
+			contentType: "application/json",
+			patch:       `{"name":"Desk lamp"}`,
+			want:        patchTarget{Name: "Desk lamp", Price: 20, Tags: []string{"home"}, Dimensions: &patchDimensions{Width: 10, Height: 30}},
+		},
+		{
+			name:       "non-object patch replaces the resource",
+			patch:      `["Lamp"]`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidRequest,
+		},
+		{
+			name:       "unknown fields are rejected",
+			patch:      `{"colour":"red"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidRequest,
+		},
+		{
+			name:       "validation runs on the merged result",
+			patch:      `{"name":null}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeValidationFailed,
+		},
+		{
+			name:       "merged values are validated",
+			patch:      `{"price":-1}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeValidationFailed,
+		},
+		{
+			name:       "malformed patch",
+			patch:      `{"price":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidRequest,
+		},
+		{
+			name:        "other media types",
+			contentType: "text/plain",
+			patch:       `{"price":25}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/products/1", strings.NewReader(tt.patch))
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = MergePatchContentType
+			}
+			c.Request.Header.Set("Content-Type", contentType)
+			c.Request.Header.Set("Accept", ProblemContentType)
+
+			obj := current()
+			ok := BindMergePatch(c, &obj)
+
+			if tt.wantStatus == 0 {
+				if !ok {
+					t.Fatalf("BindMergePatch() = false, response %d %s", w.Code, w.Body)
+				}
+				if !reflect.DeepEqual(obj, tt.want) {
+					t.Errorf("merged = %+v, want %+v", obj, tt.want)
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("BindMergePatch() = true with %+v, want status %d", obj, tt.wantStatus)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				var p Problem
+				if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Code != tt.wantCode {
+					t.Errorf("body = %s, want code %s", w.Body, tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType is the RFC 7807 media type.
+const ProblemContentType = "application/problem+json"
+
+// Stable error codes. Each maps to a problem type URI of /errors/<code>.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeUnprocessable      = "unprocessable_entity"
+	CodeRateLimited        = "rate_limited"
+	CodeRequestCanceled    = "request_canceled"
+	CodeInternal           = "internal_error"
+	CodeUpstreamError      = "upstream_error"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeUpstreamTimeout    = "upstream_timeout"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeInvalidRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeConflict,
+	http.StatusPreconditionFailed:  CodePreconditionFailed,
+	http.StatusUnprocessableEntity: CodeUnprocessable,
+	http.StatusTooManyRequests:     CodeRateLimited,
+	StatusClientClosedRequest:      CodeRequestCanceled,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusBadGateway:          CodeUpstreamError,
+	http.StatusServiceUnavailable:  CodeServiceUnavailable,
+	http.StatusGatewayTimeout:      CodeUpstreamTimeout,
+}
+
+// Problem is an RFC 7807 problem details object, extended with a stable
+// error code, per-field validation errors, data about the failed request
+// (e.g. a checkout result) and the request ID.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Data      interface{}  `json:"data,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError describes one failed binding rule on a request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+var problemJSON atomic.Bool
+
+// SetProblemJSON makes every error response problem+json. When disabled,
+// clients can still opt in with an Accept: application/problem+json header.
+func SetProblemJSON(enabled bool) {
+	problemJSON.Store(enabled)
+}
+
+// RegisterJSONFieldNames makes binding errors report JSON field names
+// (e.g. first_name) instead of Go struct field names.
+func RegisterJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+}
+
+// SendBindError reports a request that failed ShouldBind*. Validation
+// failures are listed per field in problem+json responses.
+func SendBindError(c *gin.Context, err error) {
+	if !wantsProblem(c) {
+		SendError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	p := newProblem(c, http.StatusBadRequest, "Invalid request", nil)
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		p.Code = CodeValidationFailed
+		p.Type = problemType(p.Code)
+		p.Detail = "One or more fields failed validation"
+		p.Errors = fieldErrors(verrs)
+	} else {
+		p.Detail = bindErrorDetail(err)
+	}
+	sendProblem(c, p)
+}
+
+func wantsProblem(c *gin.Context) bool {
+	return problemJSON.Load() || strings.Contains(c.GetHeader("Accept"), ProblemContentType)
+}
+
+func newProblem(c *gin.Context, statusCode int, message string, err interface{}) *Problem {
+	code, ok := statusCodes[statusCode]
+	if !ok {
+		code = CodeInternal
+		if statusCode < 500 {
+			code = CodeInvalidRequest
+		}
+	}
+
+	detail := message
+	if s, ok := err.(string); ok && s != "" {
+		detail = message + ": " + s
+	}
+
+	title := http.StatusText(statusCode)
+	if title == "" {
+		title = message
+	}
+
+	return &Problem{
+		Type:      problemType(code),
+		Title:     title,
+		Status:    statusCode,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: requestID(c),
+	}
+}
+
+func sendProblem(c *gin.Context, p *Problem) {
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(p.Status, p)
+}
+
+func problemType(code string) string {
+	return "/errors/" + code
+}
+
+func fieldErrors(verrs validator.ValidationErrors) []FieldError {
+	out := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		// Drop the top-level struct name: CreateOrderRequest.items[0].quantity
+		field := fe.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		out = append(out, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return out
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	default:
+		return fmt.Sprintf("failed %q validation", fe.Tag())
+	}
+}
+
+// bindErrorDetail describes decoding errors without echoing Go type names.
+func bindErrorDetail(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("Field %q has the wrong type", typeErr.Field)
+	case err.Error() == "EOF":
+		return "Request body is empty"
+	default:
+		return "Request body could not be parsed"
+	}
+}
@@ -1,7 +1,20 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/requestid"
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 type APIResponse struct {
@@ -9,20 +22,93 @@ type APIResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   interface{} `json:"error,omitempty"`
+	// Pagination is set on responses carrying one page of a listing.
+	Pagination *models.Pagination `json:"pagination,omitempty"`
+	RequestID  string             `json:"request_id,omitempty"`
 }
 
 func SendSuccess(c *gin.Context, statusCode int, message string, data interface{}) {
 	c.JSON(statusCode, APIResponse{
-		Success: true,
-		Message: message,
-		Data:    data,
+		Success:   true,
+		Message:   message,
+		Data:      data,
+		RequestID: requestID(c),
 	})
 }
 
+// SendError writes an error response: the APIResponse envelope by default,
+// or application/problem+json when enabled or requested via Accept.
 func SendError(c *gin.Context, statusCode int, message string, err interface{}) {
+	sendError(c, statusCode, message, err, nil)
+}
+
+// sendError is SendError with data describing the failed request, such as
+// the state a checkout was left in.
+func sendError(c *gin.Context, statusCode int, message string, err interface{}, data interface{}) {
+	if wantsProblem(c) {
+		p := newProblem(c, statusCode, message, err)
+		p.Data = data
+		sendProblem(c, p)
+		return
+	}
 	c.JSON(statusCode, APIResponse{
-		Success: false,
-		Message: message,
-		Error:   err,
+		Success:   false,
+		Message:   message,
+		Data:      data,
+		Error:     err,
+		RequestID: requestID(c),
 	})
 }
+
+func requestID(c *gin.Context) string {
+	return requestid.FromContext(c.Request.Context())
+}
+
+// SendNotFound sends a 404 whose body does not depend on why the resource is
+// missing, so ownership checks cannot be told apart from absent records.
+func SendNotFound(c *gin.Context, message string) {
+	SendError(c, http.StatusNotFound, message, "resource not found")
+}
+
+// StatusClientClosedRequest is the non-standard status logged when the client
+// went away before the upstream answered.
+const StatusClientClosedRequest = 499
+
+// SendServiceError maps an error returned by a service call to a response.
+// Upstream 4xx responses keep their status and message, upstream 5xx and
+// transport failures become a 502 without internal details, timeouts a 504,
+// and calls rejected by an open circuit breaker a 503 with Retry-After.
+func SendServiceError(c *gin.Context, message string, err error) {
+	SendServiceErrorWithData(c, message, err, nil)
+}
+
+// SendServiceErrorWithData is SendServiceError with data added to the
+// response, for failures that still produced a result worth returning.
+func SendServiceErrorWithData(c *gin.Context, message string, err error, data interface{}) {
+	var openErr *circuitbreaker.OpenError
+	var upstreamErr *upstreamerr.Error
+
+	switch {
+	case errors.As(err, &openErr):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+		sendError(c, http.StatusServiceUnavailable, "Service temporarily unavailable", err.Error(), data)
+	case errors.As(err, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound:
+		sendError(c, http.StatusNotFound, message, "resource not found", data)
+	case errors.As(err, &upstreamErr) && upstreamErr.IsClientError():
+		sendError(c, upstreamErr.StatusCode, message, upstreamErr.Message, data)
+	case errors.As(err, &upstreamErr):
+		logger.Log.Error(message,
+			zap.String("request_id", requestID(c)),
+			zap.String("service", upstreamErr.Service),
+			zap.Int("upstream_status", upstreamErr.StatusCode),
+			zap.ByteString("upstream_body", upstreamErr.Body))
+		sendError(c, http.StatusBadGateway, message, "upstream service error", data)
+	case errors.Is(err, context.DeadlineExceeded):
+		sendError(c, http.StatusGatewayTimeout, message, "upstream service timed out", data)
+	case errors.Is(err, context.Canceled):
+		sendError(c, StatusClientClosedRequest, message, "request canceled", data)
+	default:
+		logger.Log.Error(message, zap.String("request_id", requestID(c)), zap.Error(err))
+		sendError(c, http.StatusBadGateway, message, "upstream service unavailable", data)
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/requestid"
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestSendServiceError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Log = zap.NewNop()
+	upstream := func(status int, message string) error {
+		return fmt.Errorf("get user: %w", &upstreamerr.Error{Service: "user_service", StatusCode: status, Message: message, Body: []byte(`{"trace":"internal"}`)})
+	}
+
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantMessage    string // defaults to the message passed in
+		wantError      string
+		wantRetryAfter string
+	}{
+		{
+			name:           "open breaker",
+			err:            &circuitbreaker.OpenError{Name: "user_service", RetryAfter: 1500 * time.Millisecond},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantMessage:    "Service temporarily unavailable",
+			wantError:      "user_service circuit breaker is open",
+			wantRetryAfter: "2",
+		},
+		{name: "not found", err: upstream(http.StatusNotFound, "user 7 does not exist"), wantStatus: http.StatusNotFound, wantError: "resource not found"},
+		{name: "bad request", err: upstream(http.StatusBadRequest, "email is invalid"), wantStatus: http.StatusBadRequest, wantError: "email is invalid"},
+		{name: "conflict", err: upstream(http.StatusConflict, "email is taken"), wantStatus: http.StatusConflict, wantError: "email is taken"},
+		{name: "unprocessable", err: upstream(http.StatusUnprocessableEntity, "out of stock"), wantStatus: http.StatusUnprocessableEntity, wantError: "out of stock"},
+		{name: "upstream 500", err: upstream(http.StatusInternalServerError, "nil pointer"), wantStatus: http.StatusBadGateway, wantError: "upstream service error"},
+		{name: "upstream 503", err: upstream(http.StatusServiceUnavailable, "overloaded"), wantStatus: http.StatusBadGateway, wantError: "upstream service error"},
+		{name: "timeout", err: fmt.Errorf("get user: %w", context.DeadlineExceeded), wantStatus: http.StatusGatewayTimeout, wantError: "upstream service timed out"},
+		{name: "client went away", err: fmt.Errorf("get user: %w", context.Canceled), wantStatus: StatusClientClosedRequest, wantError: "request canceled"},
+		{name: "transport error", err: errors.New("dial tcp: connection refused"), wantStatus: http.StatusBadGateway, wantError: "upstream service unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/users/7", nil)
+			c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), "req-1"))
+
+			SendServiceErrorWithData(c, "Failed to get user", tt.err, gin.H{"step": "user"})
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			wantMessage := tt.wantMessage
+			if wantMessage == "" {
+				wantMessage = "Failed to get user"
+			}
+			var body APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %s: %v", w.Body, err)
+			}
+			if body.Success || body.Message != wantMessage || body.Error != tt.wantError || body.RequestID != "req-1" {
+				t.Errorf("body = %s, want %q with error %q for req-1", w.Body, wantMessage, tt.wantError)
+			}
+			if data, _ := body.Data.(map[string]interface{}); data["step"] != "user" {
+				t.Errorf("data = %v, want the step", body.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+
+	"go.uber.org/zap"
+)
+
+// CheckoutError is returned when a checkout fails. Err is the failure of the
+// step that broke the saga; Compensated tells whether it was fully undone.
+// Result is the state the checkout was left in.
+type CheckoutError struct {
+	CheckoutID  string
+	Step        string
+	Compensated bool
+	Result      *models.CheckoutResult
+	Err         error
+}
+
+func (e *CheckoutError) Error() string {
+	return fmt.Sprintf("checkout %s failed at %s: %v", e.CheckoutID, e.Step, e.Err)
+}
+
+func (e *CheckoutError) Unwrap() error {
+	return e.Err
+}
+
+// checkoutService runs checkout as a saga over the order, inventory, payment
+// and notification services: create order, reserve stock, take payment,
+// notify. If a step fails, the completed steps are compensated in reverse
+// (refund, restore stock, cancel order). Every state change is persisted
+// before moving on so Recover can finish the job after a restart.
+//
+// A forward call whose outcome is unknown (the gateway stopped, or the call
+// timed out or failed upstream) may still have taken effect. It is settled
+// by making it again with the same Idempotency-Key: the upstream either
+// replays the original result or performs the call now, and either way the
+// result is recorded and can be compensated.
+type checkoutService struct {
+	orders        OrderService
+	inventory     InventoryService
+	payments      PaymentService
+	notifications NotificationService
+	store         CheckoutStore
+	timeout       time.Duration
+}
+
+func NewCheckoutService(orders OrderService, inventory InventoryService, payments PaymentService, notifications NotificationService, store CheckoutStore, timeout time.Duration) CheckoutService {
+	return &checkoutService{
+		orders:        orders,
+		inventory:     inventory,
+		payments:      payments,
+		notifications: notifications,
+		store:         store,
+		timeout:       timeout,
+	}
+}
+
+func (s *checkoutService) Checkout(ctx context.Context, userID uint, req models.CheckoutRequest) (*models.CheckoutResult, error) {
+	id, err := newCheckoutID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	saga := &CheckoutSaga{
+		ID:        id,
+		UserID:    userID,
+		Status:    SagaRunning,
+		Request:   req,
+		CreatedAt: now,
+	}
+	if err := s.store.Save(saga); err != nil {
+		return nil, fmt.Errorf("persist checkout: %w", err)
+	}
+
+	// Once started the saga runs to the end even if the client goes away,
+	// otherwise a disconnect could leave stock reserved and nothing to undo it
+	ctx, cancel := s.detach(ctx)
+	defer cancel()
+
+	if err := s.run(ctx, saga); err != nil {
+		return nil, err
+	}
+	return sagaResult(saga), nil
+}
+
+func (s *checkoutService) Recover(ctx context.Context) error {
+	pending, err := s.store.Pending()
+	for _, saga := range pending {
+		sagaCtx, cancel := s.detach(ctx)
+		settled := s.settle(sagaCtx, saga) == nil
+		switch {
+		case saga.Status == SagaRunning && saga.Payment != nil && settled:
+			// Payment went through, only the notification is left
+			s.notify(sagaCtx, saga)
+			s.finish(saga)
+		default:
+			s.compensate(sagaCtx, saga)
+		}
+		cancel()
+		logger.Log.Info("Recovered checkout",
+			zap.String("checkout_id", saga.ID),
+			zap.String("status", saga.Status))
+	}
+	return err
+}
+
+func (s *checkoutService) run(ctx context.Context, saga *CheckoutSaga) error {
+	saga.Step = StepCreateOrder
+	if err := s.perform(ctx, saga, SagaCall{Step: StepCreateOrder}); err != nil {
+		return s.fail(ctx, saga, err)
+	}
+
+	saga.Step = StepReserveStock
+	for i := range saga.Request.Items {
+		if err := s.perform(ctx, saga, SagaCall{Step: StepReserveStock, Index: i}); err != nil {
+			return s.fail(ctx, saga, err)
+		}
+	}
+
+	saga.Step = StepProcessPayment
+	if err := s.perform(ctx, saga, SagaCall{Step: StepProcessPayment}); err != nil {
+		return s.fail(ctx, saga, err)
+	}
+
+	saga.Step = StepNotify
+	s.save(saga)
+	s.notify(ctx, saga)
+	s.finish(saga)
+	return nil
+}
+
+// perform makes one forward call and records its result. The call is
+// persisted as in flight first; it stays so while its outcome is unknown.
+func (s *checkoutService) perform(ctx context.Context, saga *CheckoutSaga, call SagaCall) error {
+	saga.InFlight = &call
+	s.save(saga)
+
+	var err error
+	switch call.Step {
+	case StepCreateOrder:
+		var order *models.Order
+		order, err = s.orders.CreateOrder(s.stepCtx(ctx, saga, call.Step), models.CreateOrderRequest{Items: saga.Request.Items})
+		if err == nil {
+			saga.Order = order
+		}
+	case StepReserveStock:
+		item := saga.Request.Items[call.Index]
+		err = s.inventory.UpdateStock(s.stepCtx(ctx, saga, call.Step, call.Index), models.UpdateInventoryRequest{
+			ProductID: item.ProductID,
+			Quantity:  -item.Quantity,
+		})
+		if err == nil {
+			saga.Reserved = append(saga.Reserved, SagaReservation{Index: call.Index, OrderItemRequest: item})
+		}
+	case StepProcessPayment:
+		var payment *models.Payment
+		payment, err = s.payments.ProcessPayment(s.stepCtx(ctx, saga, call.Step), models.CreatePaymentRequest{
+			OrderID: saga.Order.ID,
+			Amount:  saga.Order.Total,
+			Method:  saga.Request.PaymentMethod,
+		})
+		if err == nil {
+			saga.Payment = payment
+		}
+	default:
+		err = fmt.Errorf("unknown checkout step %q", call.Step)
+	}
+
+	if err == nil || notPerformed(err) {
+		saga.InFlight = nil
+	}
+	s.save(saga)
+	return err
+}
+
+// settle learns the outcome of the saga's in-flight call by making it
+// again with the same Idempotency-Key. It returns an error while the
+// outcome is still unknown.
+func (s *checkoutService) settle(ctx context.Context, saga *CheckoutSaga) error {
+	if saga.InFlight == nil {
+		return nil
+	}
+	call := *saga.InFlight
+	if err := s.perform(ctx, saga, call); err != nil && saga.InFlight != nil {
+		return fmt.Errorf("settle %s: %w", call.Step, err)
+	}
+	return nil
+}
+
+// notPerformed reports whether a failed call certainly had no effect: the
+// upstream rejected it, or an open breaker kept it from being sent. A 409
+// may mean the original call is still being processed, so it does not
+// count.
+func notPerformed(err error) bool {
+	var openErr *circuitbreaker.OpenError
+	var upstreamErr *upstreamerr.Error
+	if errors.As(err, &openErr) {
+		return true
+	}
+	return errors.As(err, &upstreamErr) && upstreamErr.IsClientError() && upstreamErr.StatusCode != http.StatusConflict
+}
+
+// notify is best effort: a failed notification does not undo a paid order.
+func (s *checkoutService) notify(ctx context.Context, saga *CheckoutSaga) {
+	err := s.notifications.SendNotification(s.stepCtx(ctx, saga, saga.Step), models.SendNotificationRequest{
+		UserID:  saga.UserID,
+		Message: fmt.Sprintf("Your order #%d has been placed", saga.Order.ID),
+	})
+	if err != nil {
+		logger.Log.Warn("Checkout notification failed",
+			zap.String("checkout_id", saga.ID),
+			zap.Error(err))
+	}
+}
+
+func (s *checkoutService) finish(saga *CheckoutSaga) {
+	saga.Status = SagaCompleted
+	s.save(saga)
+}
+
+func (s *checkoutService) fail(ctx context.Context, saga *CheckoutSaga, err error) error {
+	saga.Error = err.Error()
+	compensated := s.compensate(ctx, saga)
+	return &CheckoutError{CheckoutID: saga.ID, Step: saga.Step, Compensated: compensated, Result: sagaResult(saga), Err: err}
+}
+
+// compensate undoes completed steps in reverse order, settling the
+// in-flight call first so that it is undone too if it took effect. Progress
+// is saved after each one so a retry after a restart does not repeat them.
+// While the in-flight call stays unsettled the saga is left
+// compensation_failed, to be retried by Recover.
+func (s *checkoutService) compensate(ctx context.Context, saga *CheckoutSaga) bool {
+	saga.Status = SagaCompensating
+	s.save(saga)
+
+	var errs []error
+	if err := s.settle(ctx, saga); err != nil {
+		errs = append(errs, err)
+	}
+	if saga.Payment != nil && !saga.Refunded {
+		if _, err := s.payments.RefundPayment(s.stepCtx(ctx, saga, "refund"), saga.Payment.ID); err != nil {
+			errs = append(errs, fmt.Errorf("refund payment %d: %w", saga.Payment.ID, err))
+		} else {
+			saga.Refunded = true
+			s.save(saga)
+		}
+	}
+
+	for i := len(saga.Reserved) - 1; i >= 0; i-- {
+		item := saga.Reserved[i]
+		err := s.inventory.UpdateStock(s.stepCtx(ctx, saga, "restore", item.Index), models.UpdateInventoryRequest{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore stock for product %d: %w", item.ProductID, err))
+			continue
+		}
+		saga.Reserved = append(saga.Reserved[:i], saga.Reserved[i+1:]...)
+		s.save(saga)
+	}
+
+	if saga.Order != nil && !saga.OrderCanceled {
+		if _, err := s.orders.CancelOrder(s.stepCtx(ctx, saga, "cancel"), saga.Order.ID); err != nil {
+			errs = append(errs, fmt.Errorf("cancel order %d: %w", saga.Order.ID, err))
+		} else {
+			saga.OrderCanceled = true
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		saga.Status = SagaCompensationFailed
+		s.save(saga)
+		logger.Log.Error("Checkout compensation failed",
+			zap.String("checkout_id", saga.ID),
+			zap.Error(err))
+		return false
+	}
+
+	saga.Status = SagaCompensated
+	s.save(saga)
+	return true
+}
+
+// save persists the saga. A failed write is logged rather than failing the
+// checkout: the in-memory saga is still correct for this request.
+func (s *checkoutService) save(saga *CheckoutSaga) {
+	if err := s.store.Save(saga); err != nil {
+		logger.Log.Error("Failed to persist checkout state",
+			zap.String("checkout_id", saga.ID),
+			zap.Error(err))
+	}
+}
+
+func (s *checkoutService) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithoutCancel(ctx)
+	if s.timeout > 0 {
+		return context.WithTimeout(ctx, s.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// stepCtx tags a saga call with an Idempotency-Key derived from the saga and
+// action, so upstreams can deduplicate it if it is retried or replayed on
+// recovery, and with the user the checkout is for.
+func (s *checkoutService) stepCtx(ctx context.Context, saga *CheckoutSaga, action string, index ...int) context.Context {
+	key := saga.ID + ":" + action
+	for _, i := range index {
+		key += fmt.Sprintf(":%d", i)
+	}
+	if saga.UserID != 0 {
+		ctx = WithUserID(ctx, saga.UserID)
+	}
+	return WithIdempotencyKey(ctx, key)
+}
+
+func sagaResult(saga *CheckoutSaga) *models.CheckoutResult {
+	return &models.CheckoutResult{
+		CheckoutID: saga.ID,
+		Status:     saga.Status,
+		Order:      saga.Order,
+		Payment:    saga.Payment,
+	}
+}
+
+func newCheckoutID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
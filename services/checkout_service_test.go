@@ -0,0 +1,436 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+)
+
+// The fakes below honor Idempotency-Key like the real upstreams: a call
+// repeated with a key that already succeeded replays the first result
+// without doing anything. fail makes the next call with a key fail before
+// it takes effect, lose makes it take effect but fail anyway (a lost
+// response). Both are used once.
+
+type fakeCalls struct {
+	mu    sync.Mutex
+	keys  []string
+	fail  map[string]error
+	lose  map[string]error
+	users []uint
+}
+
+// begin records a call and returns the error it should fail with before
+// taking effect.
+func (f *fakeCalls) begin(ctx context.Context) (string, error) {
+	key := IdempotencyKeyFromContext(ctx)
+	f.keys = append(f.keys, key)
+	userID, _ := UserIDFromContext(ctx)
+	f.users = append(f.users, userID)
+	if err, ok := f.fail[key]; ok {
+		delete(f.fail, key)
+		return key, err
+	}
+	return key, nil
+}
+
+// end returns the error a call that took effect should report.
+func (f *fakeCalls) end(key string) error {
+	if err, ok := f.lose[key]; ok {
+		delete(f.lose, key)
+		return err
+	}
+	return nil
+}
+
+type fakeOrders struct {
+	OrderService
+	fakeCalls
+	created  map[string]*models.Order
+	canceled []uint
+}
+
+func (f *fakeOrders) CreateOrder(ctx context.Context, req models.CreateOrderRequest) (*models.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.begin(ctx)
+	if order, ok := f.created[key]; ok {
+		return order, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	order := &models.Order{ID: uint(len(f.created) + 1), Total: 42}
+	f.created[key] = order
+	return order, f.end(key)
+}
+
+func (f *fakeOrders) CancelOrder(ctx context.Context, id uint) (*models.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.canceled = append(f.canceled, id)
+	return &models.Order{ID: id, Status: "canceled"}, f.end(key)
+}
+
+type fakeInventory struct {
+	fakeCalls
+	stock   map[uint]int
+	applied map[string]bool
+}
+
+func (f *fakeInventory) UpdateStock(ctx context.Context, req models.UpdateInventoryRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.begin(ctx)
+	if f.applied[key] {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.stock[req.ProductID] += req.Quantity
+	f.applied[key] = true
+	return f.end(key)
+}
+
+type fakePayments struct {
+	fakeCalls
+	processed map[string]*models.Payment
+	refunded  []uint
+}
+
+func (f *fakePayments) ProcessPayment(ctx context.Context, req models.CreatePaymentRequest) (*models.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.begin(ctx)
+	if payment, ok := f.processed[key]; ok {
+		return payment, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	payment := &models.Payment{ID: uint(len(f.processed) + 1), OrderID: req.OrderID, Amount: req.Amount}
+	f.processed[key] = payment
+	return payment, f.end(key)
+}
+
+func (f *fakePayments) RefundPayment(ctx context.Context, id uint) (*models.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.refunded = append(f.refunded, id)
+	return &models.Payment{ID: id, Status: "refunded"}, f.end(key)
+}
+
+type fakeNotifications struct {
+	fakeCalls
+	sent int
+}
+
+func (f *fakeNotifications) SendNotification(ctx context.Context, req models.SendNotificationRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.begin(ctx)
+	if err != nil {
+		return err
+	}
+	f.sent++
+	return f.end(key)
+}
+
+type checkoutFixture struct {
+	svc           *checkoutService
+	store         CheckoutStore
+	orders        *fakeOrders
+	inventory     *fakeInventory
+	payments      *fakePayments
+	notifications *fakeNotifications
+}
+
+func newCheckoutFixture(t *testing.T) *checkoutFixture {
+	t.Helper()
+	store, err := NewFileCheckoutStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := func() fakeCalls { return fakeCalls{fail: map[string]error{}, lose: map[string]error{}} }
+	f := &checkoutFixture{
+		store:         store,
+		orders:        &fakeOrders{fakeCalls: calls(), created: map[string]*models.Order{}},
+		inventory:     &fakeInventory{fakeCalls: calls(), stock: map[uint]int{1: 10, 2: 10, 3: 10}, applied: map[string]bool{}},
+		payments:      &fakePayments{fakeCalls: calls(), processed: map[string]*models.Payment{}},
+		notifications: &fakeNotifications{fakeCalls: calls()},
+	}
+	f.svc = NewCheckoutService(f.orders, f.inventory, f.payments, f.notifications, store, time.Minute).(*checkoutService)
+	return f
+}
+
+// key returns the Idempotency-Key of a saga action, as stepCtx builds it.
+func (f *checkoutFixture) key(saga *CheckoutSaga, action string, index ...int) string {
+	return IdempotencyKeyFromContext(f.svc.stepCtx(context.Background(), saga, action, index...))
+}
+
+// newSaga persists a running saga without running it, so failures can be
+// keyed by its ID before it starts.
+func (f *checkoutFixture) newSaga(t *testing.T, userID uint, items ...models.OrderItemRequest) *CheckoutSaga {
+	t.Helper()
+	saga := &CheckoutSaga{
+		ID:      "saga-1",
+		UserID:  userID,
+		Status:  SagaRunning,
+		Request: models.CheckoutRequest{Items: items, PaymentMethod: "credit_card"},
+	}
+	if err := f.store.Save(saga); err != nil {
+		t.Fatal(err)
+	}
+	return saga
+}
+
+func (f *checkoutFixture) wantStock(t *testing.T, want map[uint]int) {
+	t.Helper()
+	if !maps.Equal(f.inventory.stock, want) {
+		t.Errorf("stock = %v, want %v", f.inventory.stock, want)
+	}
+}
+
+func (f *checkoutFixture) wantStored(t *testing.T, id, status string) *CheckoutSaga {
+	t.Helper()
+	saga, err := f.store.Load(id)
+	if err != nil {
+		t.Fatalf("Load(%s) = %v", id, err)
+	}
+	if saga.Status != status {
+		t.Errorf("stored status = %s, want %s", saga.Status, status)
+	}
+	return saga
+}
+
+var (
+	itemA = models.OrderItemRequest{ProductID: 1, Quantity: 1}
+	itemB = models.OrderItemRequest{ProductID: 2, Quantity: 2}
+	itemC = models.OrderItemRequest{ProductID: 3, Quantity: 3}
+
+	errBadGateway = &upstreamerr.Error{Service: "test", StatusCode: http.StatusBadGateway, Message: "bad gateway"}
+	errDeclined   = &upstreamerr.Error{Service: "payment", StatusCode: http.StatusPaymentRequired, Message: "declined"}
+	errUnavail    = &upstreamerr.Error{Service: "inventory", StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+)
+
+func TestCheckoutCompletes(t *testing.T) {
+	f := newCheckoutFixture(t)
+
+	result, err := f.svc.Checkout(context.Background(), 7, models.CheckoutRequest{
+		Items:         []models.OrderItemRequest{itemA, itemB},
+		PaymentMethod: "credit_card",
+	})
+	if err != nil {
+		t.Fatalf("Checkout() = %v", err)
+	}
+	if result.Status != SagaCompleted || result.Order == nil || result.Payment == nil {
+		t.Errorf("result = %+v, want completed with order and payment", result)
+	}
+	f.wantStock(t, map[uint]int{1: 9, 2: 8, 3: 10})
+	if f.notifications.sent != 1 {
+		t.Errorf("notifications = %d, want 1", f.notifications.sent)
+	}
+	for _, calls := range []*fakeCalls{&f.orders.fakeCalls, &f.inventory.fakeCalls, &f.payments.fakeCalls} {
+		if slices.ContainsFunc(calls.users, func(id uint) bool { return id != 7 }) {
+			t.Errorf("upstream calls made for users %v, want 7", calls.users)
+		}
+	}
+
+	f.wantStored(t, result.CheckoutID, SagaCompleted)
+	if pending, err := f.store.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() = %v, %v, want none", pending, err)
+	}
+}
+
+func TestCheckoutCompensatesDeclinedPayment(t *testing.T) {
+	f := newCheckoutFixture(t)
+	saga := f.newSaga(t, 7, itemA, itemB, itemC)
+	f.payments.fail[f.key(saga, StepProcessPayment)] = errDeclined
+
+	err := f.svc.run(context.Background(), saga)
+
+	var checkoutErr *CheckoutError
+	if !errors.As(err, &checkoutErr) || !checkoutErr.Compensated || checkoutErr.Step != StepProcessPayment {
+		t.Fatalf("run() = %v, want a compensated CheckoutError at %s", err, StepProcessPayment)
+	}
+	if checkoutErr.Result == nil || checkoutErr.Result.CheckoutID != saga.ID || checkoutErr.Result.Status != SagaCompensated {
+		t.Errorf("Result = %+v, want the compensated checkout", checkoutErr.Result)
+	}
+	f.wantStock(t, map[uint]int{1: 10, 2: 10, 3: 10})
+	if !slices.Equal(f.orders.canceled, []uint{1}) {
+		t.Errorf("canceled orders = %v, want [1]", f.orders.canceled)
+	}
+	if len(f.payments.refunded) != 0 {
+		t.Errorf("refunded = %v, want nothing for a declined payment", f.payments.refunded)
+	}
+	f.wantStored(t, saga.ID, SagaCompensated)
+}
+
+func TestCompensationRetryRestoresRemainingItems(t *testing.T) {
+	f := newCheckoutFixture(t)
+	saga := f.newSaga(t, 7, itemA, itemB, itemC)
+	f.payments.fail[f.key(saga, StepProcessPayment)] = errDeclined
+	// Restores run C, B, A: B fails once, after C was restored
+	f.inventory.fail[f.key(saga, "restore", 1)] = errUnavail
+
+	err := f.svc.run(context.Background(), saga)
+
+	var checkoutErr *CheckoutError
+	if !errors.As(err, &checkoutErr) || checkoutErr.Compensated {
+		t.Fatalf("run() = %v, want an uncompensated CheckoutError", err)
+	}
+	f.wantStock(t, map[uint]int{1: 10, 2: 8, 3: 10})
+	stored := f.wantStored(t, saga.ID, SagaCompensationFailed)
+	if len(stored.Reserved) != 1 || stored.Reserved[0].ProductID != itemB.ProductID {
+		t.Fatalf("stored reservations = %+v, want only B", stored.Reserved)
+	}
+
+	// B is now first in Reserved; its restore must still use its own key
+	if err := f.svc.Recover(context.Background()); err != nil {
+		t.Fatalf("Recover() = %v", err)
+	}
+	f.wantStock(t, map[uint]int{1: 10, 2: 10, 3: 10})
+	stored = f.wantStored(t, saga.ID, SagaCompensated)
+	if len(stored.Reserved) != 0 {
+		t.Errorf("stored reservations = %+v, want none", stored.Reserved)
+	}
+}
+
+func TestCheckoutSettlesLostReservation(t *testing.T) {
+	f := newCheckoutFixture(t)
+	saga := f.newSaga(t, 7, itemA, itemB)
+	// B's stock is taken but the response is lost, then payment is declined
+	f.inventory.lose[f.key(saga, StepReserveStock, 1)] = errBadGateway
+
+	err := f.svc.run(context.Background(), saga)
+
+	var checkoutErr *CheckoutError
+	if !errors.As(err, &checkoutErr) || !checkoutErr.Compensated || checkoutErr.Step != StepReserveStock {
+		t.Fatalf("run() = %v, want a compensated CheckoutError at %s", err, StepReserveStock)
+	}
+	f.wantStock(t, map[uint]int{1: 10, 2: 10, 3: 10})
+	if n := countKey(f.inventory.keys, f.key(saga, StepReserveStock, 1)); n != 2 {
+		t.Errorf("reserve B sent %d times, want 2 (the call and its settlement)", n)
+	}
+	stored := f.wantStored(t, saga.ID, SagaCompensated)
+	if stored.InFlight != nil {
+		t.Errorf("stored in-flight call = %+v, want none", stored.InFlight)
+	}
+}
+
+func TestCheckoutLeavesUnsettledCallForRecovery(t *testing.T) {
+	f := newCheckoutFixture(t)
+	saga := f.newSaga(t, 7, itemA)
+	payKey := f.key(saga, StepProcessPayment)
+	f.payments.fail[payKey] = errBadGateway
+	f.payments.lose[payKey] = errBadGateway
+
+	// The payment fails and so does settling it: nothing may be undone
+	// while it might still have gone through
+	if err := f.svc.run(context.Background(), saga); err == nil {
+		t.Fatal("run() = nil, want an error")
+	}
+	stored := f.wantStored(t, saga.ID, SagaCompensationFailed)
+	if stored.InFlight == nil || stored.InFlight.Step != StepProcessPayment {
+		t.Fatalf("stored in-flight call = %+v, want %s", stored.InFlight, StepProcessPayment)
+	}
+	if len(f.payments.processed) != 1 {
+		t.Fatalf("payments = %v, want the one whose response was lost", f.payments.processed)
+	}
+
+	// Recovery learns that the payment went through, so it refunds it
+	if err := f.svc.Recover(context.Background()); err != nil {
+		t.Fatalf("Recover() = %v", err)
+	}
+	f.wantStored(t, saga.ID, SagaCompensated)
+	if !slices.Equal(f.payments.refunded, []uint{1}) {
+		t.Errorf("refunded = %v, want [1]", f.payments.refunded)
+	}
+	f.wantStock(t, map[uint]int{1: 10, 2: 10, 3: 10})
+}
+
+func TestRecoverFinishesPaidCheckout(t *testing.T) {
+	f := newCheckoutFixture(t)
+	saga := f.newSaga(t, 7, itemA)
+
+	// The gateway stopped after the payment was sent: it is in flight
+	saga.Order = &models.Order{ID: 1, Total: 42}
+	saga.Reserved = []SagaReservation{{Index: 0, OrderItemRequest: itemA}}
+	saga.Step = StepProcessPayment
+	saga.InFlight = &SagaCall{Step: StepProcessPayment}
+	f.inventory.stock[1] = 9
+	f.payments.processed[f.key(saga, StepProcessPayment)] = &models.Payment{ID: 5}
+	if err := f.store.Save(saga); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.svc.Recover(context.Background()); err != nil {
+		t.Fatalf("Recover() = %v", err)
+	}
+	stored := f.wantStored(t, saga.ID, SagaCompleted)
+	if stored.Payment == nil || stored.Payment.ID != 5 || stored.InFlight != nil {
+		t.Errorf("stored saga = %+v, want payment 5 settled", stored)
+	}
+	if f.notifications.sent != 1 || len(f.payments.refunded) != 0 {
+		t.Errorf("sent %d notifications, refunded %v; want 1 and none", f.notifications.sent, f.payments.refunded)
+	}
+	f.wantStock(t, map[uint]int{1: 9, 2: 10, 3: 10})
+}
+
+func TestFileCheckoutStorePending(t *testing.T) {
+	store, err := NewFileCheckoutStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range map[string]string{
+		"running":      SagaRunning,
+		"done":         SagaCompleted,
+		"undone":       SagaCompensated,
+		"compensating": SagaCompensating,
+		"failed":       SagaCompensationFailed,
+	} {
+		if err := store.Save(&CheckoutSaga{ID: id, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := store.Pending()
+	if err != nil {
+		t.Fatalf("Pending() = %v", err)
+	}
+	var ids []string
+	for _, saga := range pending {
+		ids = append(ids, saga.ID)
+	}
+	slices.Sort(ids)
+	if want := []string{"compensating", "failed", "running"}; !slices.Equal(ids, want) {
+		t.Errorf("Pending() = %v, want %v", ids, want)
+	}
+}
+
+func countKey(keys []string, key string) int {
+	n := 0
+	for _, k := range keys {
+		if k == key {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ecommerce-go-api-gateway/models"
+)
+
+// Checkout saga statuses.
+const (
+	SagaRunning            = "running"
+	SagaCompleted          = "completed"
+	SagaCompensating       = "compensating"
+	SagaCompensated        = "compensated"
+	SagaCompensationFailed = "compensation_failed"
+)
+
+// Checkout saga steps.
+const (
+	StepCreateOrder    = "create_order"
+	StepReserveStock   = "reserve_stock"
+	StepProcessPayment = "process_payment"
+	StepNotify         = "notify"
+)
+
+// CheckoutSaga is the persisted state of one checkout. It records enough
+// to finish or undo the checkout after a gateway restart.
+type CheckoutSaga struct {
+	ID      string                 `json:"id"`
+	UserID  uint                   `json:"user_id"`
+	Status  string                 `json:"status"`
+	Step    string                 `json:"step"`
+	Request models.CheckoutRequest `json:"request"`
+
+	// InFlight is the forward call made last whose outcome is not known
+	// yet, for example because the gateway stopped while it was running.
+	InFlight *SagaCall `json:"in_flight,omitempty"`
+
+	Order    *models.Order     `json:"order,omitempty"`
+	Reserved []SagaReservation `json:"reserved,omitempty"`
+	Payment  *models.Payment   `json:"payment,omitempty"`
+
+	OrderCanceled bool   `json:"order_canceled,omitempty"`
+	Refunded      bool   `json:"refunded,omitempty"`
+	Error         string `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SagaCall identifies one forward call of a saga: a step and, for
+// reserve_stock, the index of the item.
+type SagaCall struct {
+	Step  string `json:"step"`
+	Index int    `json:"index,omitempty"`
+}
+
+// SagaReservation is stock reserved for one item, still to be restored if
+// the saga is compensated. Index is the item's position in the request; it
+// keys both the reserve and the restore call, so the keys stay stable while
+// restored items are removed from Reserved.
+type SagaReservation struct {
+	Index int `json:"index"`
+	models.OrderItemRequest
+}
+
+// CheckoutStore persists checkout sagas.
+type CheckoutStore interface {
+	Save(saga *CheckoutSaga) error
+	Load(id string) (*CheckoutSaga, error)
+	// Pending returns sagas that are neither completed nor compensated.
+	Pending() ([]*CheckoutSaga, error)
+}
+
+// fileCheckoutStore keeps one JSON file per saga in a directory.
+type fileCheckoutStore struct {
+	dir string
+}
+
+func NewFileCheckoutStore(dir string) (CheckoutStore, error) {
+	if dir == "" {
+		return nil, errors.New("checkout state dir is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create checkout state dir: %w", err)
+	}
+	return &fileCheckoutStore{dir: dir}, nil
+}
+
+func (s *fileCheckoutStore) Save(saga *CheckoutSaga) error {
+	saga.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(saga, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a crash never leaves a half-written file behind
+	tmp, err := os.CreateTemp(s.dir, saga.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(saga.ID))
+}
+
+func (s *fileCheckoutStore) Load(id string) (*CheckoutSaga, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	var saga CheckoutSaga
+	if err := json.Unmarshal(data, &saga); err != nil {
+		return nil, err
+	}
+	return &saga, nil
+}
+
+func (s *fileCheckoutStore) Pending() ([]*CheckoutSaga, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*CheckoutSaga
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		saga, err := s.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name(), err))
+			continue
+		}
+		if saga.Status != SagaCompleted && saga.Status != SagaCompensated {
+			pending = append(pending, saga)
+		}
+	}
+	return pending, errors.Join(errs...)
+}
+
+func (s *fileCheckoutStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// newClient builds the resty client for one upstream service from its
+// connect/read timeouts and retry policy.
+func newClient(cfg config.ClientConfig) *resty.Client {
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = cfg.ReadTimeout
+
+	client := resty.New().SetTransport(transport)
+	if cfg.MaxRetries > 0 {
+		client.SetRetryCount(cfg.MaxRetries).
+			AddRetryCondition(retryCondition(cfg))
+		if cfg.BackoffBase > 0 {
+			client.SetRetryWaitTime(cfg.BackoffBase)
+		}
+		if cfg.BackoffCap > 0 {
+			client.SetRetryMaxWaitTime(cfg.BackoffCap)
+		}
+	}
+	return client
+}
+
+// retryCondition retries transport errors and the configured status codes,
+// but only for idempotent methods or requests carrying an Idempotency-Key.
+func retryCondition(cfg config.ClientConfig) resty.RetryConditionFunc {
+	methods := make(map[string]bool, len(cfg.RetryMethods))
+	for _, m := range cfg.RetryMethods {
+		methods[strings.ToUpper(m)] = true
+	}
+	statuses := make(map[int]bool, len(cfg.RetryStatusCodes))
+	for _, code := range cfg.RetryStatusCodes {
+		statuses[code] = true
+	}
+
+	return func(resp *resty.Response, err error) bool {
+		if resp == nil || resp.Request == nil {
+			return false
+		}
+		req := resp.Request
+		if !methods[req.Method] && req.Header.Get(IdempotencyKeyHeader) == "" {
+			return false
+		}
+		if err != nil {
+			return true
+		}
+		return statuses[resp.StatusCode()]
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// flightGroup collapses identical calls in flight at the same time into
+// one, in the manner of golang.org/x/sync/singleflight.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	dups int // callers that joined
+	resp *resty.Response
+	err  error
+}
+
+// do runs call unless one is already in flight for key, and waits for its
+// result or for ctx to end. call runs detached from any one caller, so it
+// must be bound by a timeout of its own. joined reports whether another
+// caller's call was joined.
+func (g *flightGroup) do(ctx context.Context, key string, call func() (*resty.Response, error)) (*resty.Response, bool, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, joined := g.flights[key]
+	if joined {
+		f.dups++
+	} else {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+		go func() {
+			f.resp, f.err = call()
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.resp, joined, f.err
+	case <-ctx.Done():
+		return nil, joined, ctx.Err()
+	}
+}
+
+// callerScope identifies who a call is made for, so that calls for
+// different users are never shared.
+func callerScope(ctx context.Context) string {
+	if id, ok := UserIDFromContext(ctx); ok {
+		return "user:" + strconv.FormatUint(uint64(id), 10)
+	}
+	return "anonymous"
+}
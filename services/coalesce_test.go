@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/requestid"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// sharedServer is an upstream that holds every request until released and
+// records the headers each one was sent with.
+type sharedServer struct {
+	*httptest.Server
+	arrived chan http.Header
+	release chan struct{}
+	done    chan struct{} // signalled as each request finishes
+	once    sync.Once
+}
+
+func newSharedServer(t *testing.T) *sharedServer {
+	s := &sharedServer{arrived: make(chan http.Header, 10), release: make(chan struct{}), done: make(chan struct{}, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.arrived <- r.Header.Clone()
+		select {
+		case <-s.release:
+			w.Write([]byte(`{"id":1}`))
+		case <-r.Context().Done():
+		}
+		s.done <- struct{}{}
+	}))
+	t.Cleanup(func() {
+		s.unblock()
+		s.Close()
+	})
+	return s
+}
+
+func (s *sharedServer) unblock() { s.once.Do(func() { close(s.release) }) }
+
+func newTestUpstream(baseURL string, timeout time.Duration) *upstream {
+	return newUpstream(ProductServiceName, baseURL, resty.New(), config.ClientConfig{Timeout: timeout}, nil)
+}
+
+type sharedResult struct {
+	resp *resty.Response
+	err  error
+}
+
+// getShared calls GetProduct 1 through doShared in the background.
+func getShared(ctx context.Context, u *upstream) <-chan sharedResult {
+	result := make(chan sharedResult, 1)
+	go func() {
+		resp, err := u.doShared(ctx, "GetProduct", "1", func(r *resty.Request) (*resty.Response, error) {
+			return r.Get("/products/1")
+		})
+		result <- sharedResult{resp, err}
+	}()
+	return result
+}
+
+// waitJoined waits until n callers joined the call in flight for GetProduct 1
+// made for ctx's caller.
+func waitJoined(t *testing.T, ctx context.Context, u *upstream, n int) {
+	t.Helper()
+	key := "GetProduct?1|" + callerScope(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		u.flights.mu.Lock()
+		f := u.flights.flights[key]
+		joined := f != nil && f.dups >= n
+		u.flights.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers did not join %s", n, key)
+}
+
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		var zero T
+		return zero
+	}
+}
+
+func TestDoSharedScopes(t *testing.T) {
+	tests := []struct {
+		name         string
+		first        context.Context
+		second       context.Context
+		wantRequests int
+	}{
+		{name: "same user", first: WithUserID(context.Background(), 1), second: WithUserID(context.Background(), 1), wantRequests: 1},
+		{name: "anonymous", first: context.Background(), second: context.Background(), wantRequests: 1},
+		{name: "different users", first: WithUserID(context.Background(), 1), second: WithUserID(context.Background(), 2), wantRequests: 2},
+		{name: "user and anonymous", first: WithUserID(context.Background(), 1), second: context.Background(), wantRequests: 2},
+		{name: "fresh read", first: WithUserID(context.Background(), 1), second: WithFreshRead(WithUserID(context.Background(), 1)), wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSharedServer(t)
+			u := newTestUpstream(server.URL, time.Minute)
+
+			first := getShared(tt.first, u)
+			receive(t, server.arrived, "the first request")
+			second := getShared(tt.second, u)
+			if tt.wantRequests == 1 {
+				waitJoined(t, tt.first, u, 1)
+			} else {
+				receive(t, server.arrived, "the second request")
+			}
+			server.unblock()
+
+			for i, result := range []<-chan sharedResult{first, second} {
+				r := receive(t, result, "a result")
+				if r.err != nil || r.resp.StatusCode() != http.StatusOK || string(r.resp.Body()) != `{"id":1}` {
+					t.Errorf("caller %d: got %v, %v", i+1, r.resp, r.err)
+				}
+			}
+			if extra := len(server.arrived); extra != 0 {
+				t.Errorf("%d more requests than expected", extra)
+			}
+		})
+	}
+}
+
+func TestDoSharedPropagation(t *testing.T) {
+	server := newSharedServer(t)
+	u := newTestUpstream(server.URL, time.Minute)
+
+	leader, leaderCalls := TrackUpstreamCalls(WithIdempotencyKey(requestid.NewContext(WithUserID(context.Background(), 1), "req-1"), "key-1"))
+	joiner, joinerCalls := TrackUpstreamCalls(requestid.NewContext(WithUserID(context.Background(), 1), "req-2"))
+
+	first := getShared(leader, u)
+	header := receive(t, server.arrived, "the request")
+	second := getShared(joiner, u)
+	waitJoined(t, leader, u, 1)
+	server.unblock()
+	receive(t, first, "the leader's result")
+	receive(t, second, "the joiner's result")
+
+	if got := header.Get(UserIDHeader); got != "1" {
+		t.Errorf("%s = %q, want the shared user 1", UserIDHeader, got)
+	}
+	if got := header.Get(requestid.Header); got != "req-1" {
+		t.Errorf("%s = %q, want the leader's req-1", requestid.Header, got)
+	}
+	if got := header.Get(IdempotencyKeyHeader); got != "" {
+		t.Errorf("%s = %q, want none", IdempotencyKeyHeader, got)
+	}
+
+	for name, tt := range map[string]struct {
+		calls      *UpstreamCalls
+		wantShared bool
+	}{
+		"leader": {leaderCalls, false},
+		"joiner": {joinerCalls, true},
+	} {
+		list := tt.calls.List()
+		if len(list) != 1 {
+			t.Errorf("%s recorded %d calls, want 1", name, len(list))
+			continue
+		}
+		if call := list[0]; call.Operation != "product.GetProduct" || call.Status != http.StatusOK || call.Shared != tt.wantShared {
+			t.Errorf("%s recorded %+v, want product.GetProduct 200 shared=%v", name, call, tt.wantShared)
+		}
+	}
+}
+
+func TestDoSharedLeaderCancel(t *testing.T) {
+	server := newSharedServer(t)
+	u := newTestUpstream(server.URL, time.Minute)
+
+	ctx, cancel := context.WithCancel(WithUserID(context.Background(), 1))
+	first := getShared(ctx, u)
+	receive(t, server.arrived, "the request")
+	second := getShared(WithUserID(context.Background(), 1), u)
+	waitJoined(t, ctx, u, 1)
+
+	cancel()
+	if r := receive(t, first, "the leader's result"); !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("leader got %v, %v, want context.Canceled", r.resp, r.err)
+	}
+	select {
+	case <-server.done:
+		t.Fatal("the shared request was cancelled with the leader")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.unblock()
+	if r := receive(t, second, "the joiner's result"); r.err != nil || r.resp.StatusCode() != http.StatusOK {
+		t.Errorf("joiner got %v, %v, want 200", r.resp, r.err)
+	}
+}
+
+func TestDoSharedTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		sharedTimeout time.Duration
+	}{
+		{name: "service timeout", timeout: 50 * time.Millisecond, sharedTimeout: time.Hour},
+		{name: "no service timeout", timeout: 0, sharedTimeout: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSharedServer(t)
+			u := newTestUpstream(server.URL, tt.timeout)
+			u.sharedTimeout = tt.sharedTimeout
+
+			r := receive(t, getShared(context.Background(), u), "the result")
+			if !errors.Is(r.err, context.DeadlineExceeded) {
+				t.Errorf("got %v, %v, want context.DeadlineExceeded", r.resp, r.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader lets upstreams deduplicate retried writes.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey attaches the client's Idempotency-Key to ctx so it is
+// forwarded upstream and makes the call eligible for retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key set by WithIdempotencyKey.
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key
+}
+
+// UserIDHeader carries the authenticated user's ID to the upstreams.
+const UserIDHeader = "X-User-ID"
+
+type userIDCtxKey struct{}
+
+// WithUserID attaches the authenticated user's ID to ctx, so it is sent
+// upstream and load balancing can keep a user on one endpoint.
+func WithUserID(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, userIDCtxKey{}, id)
+}
+
+// UserIDFromContext returns the ID set by WithUserID.
+func UserIDFromContext(ctx context.Context) (uint, bool) {
+	id, ok := ctx.Value(userIDCtxKey{}).(uint)
+	return id, ok
+}
+
+type freshReadCtxKey struct{}
+
+// WithFreshRead marks reads made with ctx as needing the current data, for
+// example to check a precondition, so they skip the response cache.
+func WithFreshRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadCtxKey{}, true)
+}
+
+func isFreshRead(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadCtxKey{}).(bool)
+	return fresh
+}
+
+// UpstreamCall is the outcome of one service call, as reported in the
+// access log. Status is 0 when no response was received. Shared is set when
+// the call was served by a request made for another caller.
+type UpstreamCall struct {
+	Operation string
+	Status    int
+	Duration  time.Duration
+	Retries   int
+	Shared    bool
+}
+
+// UpstreamCalls collects the service calls made while serving a request.
+type UpstreamCalls struct {
+	mu    sync.Mutex
+	calls []UpstreamCall
+}
+
+type upstreamCallsCtxKey struct{}
+
+// TrackUpstreamCalls returns a ctx under which every service call is
+// recorded in the returned collector.
+func TrackUpstreamCalls(ctx context.Context) (context.Context, *UpstreamCalls) {
+	calls := &UpstreamCalls{}
+	return context.WithValue(ctx, upstreamCallsCtxKey{}, calls), calls
+}
+
+// List returns the calls recorded so far.
+func (u *UpstreamCalls) List() []UpstreamCall {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]UpstreamCall(nil), u.calls...)
+}
+
+func recordUpstreamCall(ctx context.Context, call UpstreamCall) {
+	calls, ok := ctx.Value(upstreamCallsCtxKey{}).(*UpstreamCalls)
+	if !ok {
+		return
+	}
+	calls.mu.Lock()
+	calls.calls = append(calls.calls, call)
+	calls.mu.Unlock()
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func newUpstreamError(service string, resp *resty.Response) *upstreamerr.Error {
+	e := &upstreamerr.Error{
+		Service:    service,
+		StatusCode: resp.StatusCode(),
+		Body:       resp.Body(),
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(e.Body, &body); err == nil {
+		e.Code, _ = body["code"].(string)
+		if msg, ok := body["error"].(string); ok && msg != "" {
+			e.Message = msg
+		} else if msg, ok := body["message"].(string); ok {
+			e.Message = msg
+		}
+	}
+	if e.Message == "" {
+		e.Message = strings.TrimSpace(resp.String())
+	}
+	if e.Message == "" {
+		e.Message = resp.Status()
+	}
+	return e
+}
@@ -1,39 +1,74 @@
 package services
 
 import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/cache"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
+	"ecommerce-go-api-gateway/pkg/discovery"
+	"ecommerce-go-api-gateway/pkg/loadbalancer"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/metrics"
 
 	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
 )
 
 type UserService interface {
-	Login(req models.LoginRequest) (*models.LoginResponse, error)
-	Register(req models.CreateUserRequest) (*models.User, error)
-	GetUser(id uint) (*models.User, error)
+	Login(ctx context.Context, req models.LoginRequest) (*models.LoginResponse, error)
+	Register(ctx context.Context, req models.CreateUserRequest) (*models.User, error)
+	GetUser(ctx context.Context, id uint) (*models.User, error)
+	UpdateUser(ctx context.Context, id uint, req models.UpdateUserRequest) (*models.User, error)
+	DeleteUser(ctx context.Context, id uint) error
 }
 
 type ProductService interface {
-	GetProduct(id uint) (*models.Product, error)
-	ListProducts() ([]models.Product, error)
-	CreateProduct(req models.CreateProductRequest) (*models.Product, error)
+	GetProduct(ctx context.Context, id uint) (*models.Product, error)
+	ListProducts(ctx context.Context, query models.ProductQuery) (*models.ProductPage, error)
+	CreateProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error)
+	UpdateProduct(ctx context.Context, id uint, req models.UpdateProductRequest) (*models.Product, error)
+	DeleteProduct(ctx context.Context, id uint) error
 }
 
 type OrderService interface {
-	CreateOrder(req models.CreateOrderRequest) (*models.Order, error)
-	GetOrder(id uint) (*models.Order, error)
+	CreateOrder(ctx context.Context, req models.CreateOrderRequest) (*models.Order, error)
+	GetOrder(ctx context.Context, id uint) (*models.Order, error)
+	// ListOrders returns the orders placed by userID.
+	ListOrders(ctx context.Context, userID uint) ([]models.Order, error)
+	CancelOrder(ctx context.Context, id uint) (*models.Order, error)
 }
 
 type PaymentService interface {
-	ProcessPayment(req models.CreatePaymentRequest) (*models.Payment, error)
+	ProcessPayment(ctx context.Context, req models.CreatePaymentRequest) (*models.Payment, error)
+	RefundPayment(ctx context.Context, id uint) (*models.Payment, error)
 }
 
 type InventoryService interface {
-	UpdateStock(req models.UpdateInventoryRequest) error
+	UpdateStock(ctx context.Context, req models.UpdateInventoryRequest) error
 }
 
 type NotificationService interface {
-	SendNotification(req models.SendNotificationRequest) error
+	SendNotification(ctx context.Context, req models.SendNotificationRequest) error
+}
+
+type CheckoutService interface {
+	Checkout(ctx context.Context, userID uint, req models.CheckoutRequest) (*models.CheckoutResult, error)
+	// Recover finishes or compensates checkouts left incomplete by a restart.
+	Recover(ctx context.Context) error
+}
+
+// ProxyService forwards requests for the routes declared under proxy in
+// the config.
+type ProxyService interface {
+	Forward(ctx context.Context, req ProxyRequest) (*ProxyResponse, error)
 }
 
 type ServiceContainer struct {
@@ -43,16 +78,267 @@ type ServiceContainer struct {
 	Payment      PaymentService
 	Inventory    InventoryService
 	Notification NotificationService
+	Checkout     CheckoutService
+	Proxy        ProxyService
+
+	mu        sync.RWMutex
+	upstreams map[string]*upstream
+	applied   map[string]appliedClient
+	breakers  map[string]*circuitbreaker.Breaker
+	balancers map[string]*loadbalancer.Balancer
+
+	// services is the services config last applied, and discovered the
+	// endpoints found by service discovery, which take precedence over it.
+	services   config.ServicesConfig
+	discovered map[string][]config.EndpointConfig
+}
+
+// appliedClient is the configuration an upstream was last built from.
+type appliedClient struct {
+	balancer config.BalancerConfig
+	cfg      config.ClientConfig
+}
+
+// serviceNames lists the upstream services in a stable order.
+var serviceNames = []string{
+	UserServiceName,
+	ProductServiceName,
+	OrderServiceName,
+	PaymentServiceName,
+	InventoryServiceName,
+	NotificationServiceName,
+}
+
+// discoveryTimeout bounds the lookup of the initial endpoints.
+const discoveryTimeout = 5 * time.Second
+
+// NewServiceContainer builds every service client, resolving the endpoints
+// of each service with provider. Services it cannot resolve use the
+// endpoints in the services config.
+func NewServiceContainer(cfg *config.Config, provider discovery.Provider) *ServiceContainer {
+	sc := &ServiceContainer{
+		upstreams:  make(map[string]*upstream),
+		applied:    make(map[string]appliedClient),
+		breakers:   make(map[string]*circuitbreaker.Breaker),
+		balancers:  make(map[string]*loadbalancer.Balancer),
+		services:   cfg.Services,
+		discovered: make(map[string][]config.EndpointConfig),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	for _, name := range serviceNames {
+		endpoints, err := provider.Resolve(ctx, name)
+		if err != nil {
+			logger.Log.Warn("Service discovery failed, using the services config",
+				zap.String("service", name), zap.Error(err))
+			continue
+		}
+		sc.discovered[name] = endpoints
+	}
+
+	build := func(name string) (string, *resty.Client, config.ClientConfig, *circuitbreaker.Breaker) {
+		applied := sc.target(name)
+		baseURL, client, err := sc.newClient(name, applied)
+		if err != nil {
+			logger.Log.Fatal("Invalid service configuration", zap.Error(err))
+		}
+		sc.applied[name] = applied
+		return baseURL, client, applied.cfg, sc.newBreaker(name, applied.cfg)
+	}
+
+	user := NewUserService(build(UserServiceName)).(*userService)
+	product := NewProductService(build(ProductServiceName)).(*productService)
+	order := NewOrderService(build(OrderServiceName)).(*orderService)
+	payment := NewPaymentService(build(PaymentServiceName)).(*paymentService)
+	inventory := NewInventoryService(build(InventoryServiceName)).(*inventoryService)
+	notification := NewNotificationService(build(NotificationServiceName)).(*notificationService)
+
+	sc.User, sc.upstreams[UserServiceName] = user, user.upstream
+	sc.Product, sc.upstreams[ProductServiceName] = product, product.upstream
+	sc.Order, sc.upstreams[OrderServiceName] = order, order.upstream
+	sc.Payment, sc.upstreams[PaymentServiceName] = payment, payment.upstream
+	sc.Inventory, sc.upstreams[InventoryServiceName] = inventory, inventory.upstream
+	sc.Notification, sc.upstreams[NotificationServiceName] = notification, notification.upstream
+
+	if cfg.Cache.Enabled {
+		store, err := cache.NewStore(cfg.Cache)
+		if err != nil {
+			logger.Log.Fatal("Failed to create cache store", zap.Error(err))
+		}
+		products := newProductCache(store, cfg.Cache)
+		sc.Product = &cachedProductService{ProductService: product, cache: products}
+		sc.Inventory = &invalidatingInventoryService{InventoryService: inventory, cache: products}
+	}
+
+	checkoutStore, err := NewFileCheckoutStore(cfg.Checkout.StateDir)
+	if err != nil {
+		logger.Log.Fatal("Failed to open checkout store", zap.Error(err))
+	}
+	sc.Checkout = NewCheckoutService(sc.Order, sc.Inventory, sc.Payment, sc.Notification, checkoutStore, cfg.Checkout.Timeout)
+	sc.Proxy = newProxyService(sc.upstreams)
+	return sc
+}
+
+// Reload rebuilds the client of every service whose endpoints, load
+// balancing or client settings changed in cfg. A breaker is kept, with its
+// state, unless its own settings changed. It returns the names of the
+// services that were rebuilt.
+func (sc *ServiceContainer) Reload(cfg *config.Config) []string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.services = cfg.Services
+	var rebuilt []string
+	for _, name := range serviceNames {
+		if sc.rebuild(name) {
+			rebuilt = append(rebuilt, name)
+		}
+	}
+	return rebuilt
+}
+
+// SetEndpoints applies endpoints found by service discovery, rebuilding the
+// service's client if they changed. No endpoints puts the service back on
+// the services config. It reports whether the client was rebuilt.
+func (sc *ServiceContainer) SetEndpoints(name string, endpoints []config.EndpointConfig) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if _, ok := sc.upstreams[name]; !ok {
+		return false
+	}
+	sc.discovered[name] = endpoints
+	return sc.rebuild(name)
+}
+
+// Endpoints returns the endpoints a service is currently called at.
+func (sc *ServiceContainer) Endpoints(name string) []config.EndpointConfig {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.applied[name].balancer.Endpoints
+}
+
+// ServiceNames lists the upstream services in a stable order.
+func (sc *ServiceContainer) ServiceNames() []string {
+	return append([]string(nil), serviceNames...)
+}
+
+// target is the configuration a service's client should be built from.
+func (sc *ServiceContainer) target(name string) appliedClient {
+	balancer := sc.services.Balancer(name)
+	if endpoints := sc.discovered[name]; len(endpoints) > 0 {
+		balancer.Endpoints = endpoints
+	}
+	return appliedClient{balancer: balancer, cfg: sc.services.Client(name)}
+}
+
+// rebuild rebuilds the client of a service if its target changed. sc.mu
+// must be held.
+func (sc *ServiceContainer) rebuild(name string) bool {
+	next := sc.target(name)
+	prev := sc.applied[name]
+	if reflect.DeepEqual(prev, next) {
+		return false
+	}
+
+	baseURL, client, err := sc.newClient(name, next)
+	if err != nil {
+		logger.Log.Error("Failed to rebuild service client", zap.String("service", name), zap.Error(err))
+		return false
+	}
+	breaker := sc.breakers[name]
+	if prev.cfg.Breaker != next.cfg.Breaker {
+		delete(sc.breakers, name)
+		breaker = sc.newBreaker(name, next.cfg)
+	}
+	sc.upstreams[name].configure(baseURL, client, next.cfg, breaker)
+	sc.applied[name] = next
+	return true
+}
+
+// Breakers returns the circuit breaker of every service that has one enabled.
+func (sc *ServiceContainer) Breakers() []*circuitbreaker.Breaker {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	breakers := make([]*circuitbreaker.Breaker, 0, len(sc.breakers))
+	for _, name := range serviceNames {
+		if b := sc.breakers[name]; b != nil {
+			breakers = append(breakers, b)
+		}
+	}
+	return breakers
+}
+
+// Balancers returns the load balancer of every service with several
+// endpoints.
+func (sc *ServiceContainer) Balancers() []*loadbalancer.Balancer {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	balancers := make([]*loadbalancer.Balancer, 0, len(sc.balancers))
+	for _, name := range serviceNames {
+		if b := sc.balancers[name]; b != nil {
+			balancers = append(balancers, b)
+		}
+	}
+	return balancers
+}
+
+// newClient builds the client for a service and returns the base URL it
+// calls. A service with several endpoints gets a load balancer, and its
+// calls go to a placeholder host that the balancer replaces.
+func (sc *ServiceContainer) newClient(name string, applied appliedClient) (string, *resty.Client, error) {
+	client := newClient(applied.cfg)
+	endpoints := applied.balancer.Endpoints
+	if len(endpoints) <= 1 {
+		delete(sc.balancers, name)
+		if len(endpoints) == 0 {
+			return "", client, nil
+		}
+		return endpoints[0].URL, client, nil
+	}
+
+	b, err := loadbalancer.New(name, applied.balancer, client.GetClient().Transport, balanceKey)
+	if err != nil {
+		return "", nil, err
+	}
+	b.OnEjection(func(name, endpoint string, ejected bool) {
+		metrics.SetEndpointEjected(name, endpoint, ejected)
+		if ejected {
+			logger.Log.Warn("Upstream endpoint ejected", zap.String("service", name), zap.String("endpoint", endpoint))
+			return
+		}
+		logger.Log.Info("Upstream endpoint returned to rotation", zap.String("service", name), zap.String("endpoint", endpoint))
+	})
+	sc.balancers[name] = b
+	client.SetTransport(b)
+	return "http://" + strings.ReplaceAll(name, "_", "-"), client, nil
+}
+
+// balanceKey hashes calls on the authenticated user for consistent_hash.
+func balanceKey(r *http.Request) string {
+	if id, ok := UserIDFromContext(r.Context()); ok {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	return ""
 }
 
-func NewServiceContainer(cfg *config.Config) *ServiceContainer {
-	client := resty.New()
-	return &ServiceContainer{
-		User:         NewUserService(cfg.Services.UserService, client),
-		Product:      NewProductService(cfg.Services.ProductService, client),
-		Order:        NewOrderService(cfg.Services.OrderService, client),
-		Payment:      NewPaymentService(cfg.Services.PaymentService, client),
-		Inventory:    NewInventoryService(cfg.Services.InventoryService, client),
-		Notification: NewNotificationService(cfg.Services.NotificationService, client),
+func (sc *ServiceContainer) newBreaker(name string, cfg config.ClientConfig) *circuitbreaker.Breaker {
+	b := circuitbreaker.New(name, cfg.Breaker)
+	if b == nil {
+		return nil
 	}
+	metrics.SetBreakerState(name, int(b.State()))
+	b.OnStateChange(func(name string, from, to circuitbreaker.State) {
+		metrics.SetBreakerState(name, int(to))
+		metrics.BreakerTransition(name, from.String(), to.String())
+		logger.Log.Warn("Circuit breaker state changed",
+			zap.String("service", name),
+			zap.String("from", from.String()),
+			zap.String("to", to.String()))
+	})
+	sc.breakers[name] = b
+	return b
 }
@@ -1,31 +1,34 @@
 package services
 
 import (
+	"context"
+	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
-	"fmt"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
 
 	"github.com/go-resty/resty/v2"
 )
 
 type inventoryService struct {
-	baseURL string
-	client  *resty.Client
+	*upstream
 }
 
-func NewInventoryService(baseURL string, client *resty.Client) InventoryService {
-	return &inventoryService{baseURL: baseURL, client: client}
+func NewInventoryService(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) InventoryService {
+	return &inventoryService{upstream: newUpstream(InventoryServiceName, baseURL, client, cfg, breaker)}
 }
 
-func (s *inventoryService) UpdateStock(req models.UpdateInventoryRequest) error {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/inventory/stock")
+func (s *inventoryService) UpdateStock(ctx context.Context, req models.UpdateInventoryRequest) error {
+	resp, err := s.do(ctx, "UpdateStock", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/inventory/stock")
+	})
 
 	if err != nil {
 		return err
 	}
 	if resp.IsError() {
-		return fmt.Errorf("inventory service error: %s", resp.String())
+		return newUpstreamError(InventoryServiceName, resp)
 	}
 	return nil
 }
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"ecommerce-go-api-gateway/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
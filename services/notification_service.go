@@ -1,31 +1,34 @@
 package services
 
 import (
+	"context"
+	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
-	"fmt"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
 
 	"github.com/go-resty/resty/v2"
 )
 
 type notificationService struct {
-	baseURL string
-	client  *resty.Client
+	*upstream
 }
 
-func NewNotificationService(baseURL string, client *resty.Client) NotificationService {
-	return &notificationService{baseURL: baseURL, client: client}
+func NewNotificationService(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) NotificationService {
+	return &notificationService{upstream: newUpstream(NotificationServiceName, baseURL, client, cfg, breaker)}
 }
 
-func (s *notificationService) SendNotification(req models.SendNotificationRequest) error {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/notifications")
+func (s *notificationService) SendNotification(ctx context.Context, req models.SendNotificationRequest) error {
+	resp, err := s.do(ctx, "SendNotification", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/notifications")
+	})
 
 	if err != nil {
 		return err
 	}
 	if resp.IsError() {
-		return fmt.Errorf("notification service error: %s", resp.String())
+		return newUpstreamError(NotificationServiceName, resp)
 	}
 	return nil
 }
@@ -1,7 +1,10 @@
 package services
 
 import (
+	"context"
+	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
 	"encoding/json"
 	"fmt"
 
@@ -9,24 +12,25 @@ import (
 )
 
 type orderService struct {
-	baseURL string
-	client  *resty.Client
+	*upstream
 }
 
-func NewOrderService(baseURL string, client *resty.Client) OrderService {
-	return &orderService{baseURL: baseURL, client: client}
+func NewOrderService(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) OrderService {
+	return &orderService{upstream: newUpstream(OrderServiceName, baseURL, client, cfg, breaker)}
 }
 
-func (s *orderService) CreateOrder(req models.CreateOrderRequest) (*models.Order, error) {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/orders")
+func (s *orderService) CreateOrder(ctx context.Context, req models.CreateOrderRequest) (*models.Order, error) {
+	resp, err := s.do(ctx, "CreateOrder", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/orders")
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("order service error: %s", resp.String())
+		return nil, newUpstreamError(OrderServiceName, resp)
 	}
 
 	var order models.Order
@@ -36,15 +40,56 @@ func (s *orderService) CreateOrder(req models.CreateOrderRequest) (*models.Order
 	return &order, nil
 }
 
-func (s *orderService) GetOrder(id uint) (*models.Order, error) {
-	resp, err := s.client.R().
-		Get(fmt.Sprintf("%s/orders/%d", s.baseURL, id))
+func (s *orderService) GetOrder(ctx context.Context, id uint) (*models.Order, error) {
+	resp, err := s.doShared(ctx, "GetOrder", fmt.Sprint(id), func(r *resty.Request) (*resty.Response, error) {
+		return r.Get(fmt.Sprintf("/orders/%d", id))
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("order service error: %s", resp.String())
+		return nil, newUpstreamError(OrderServiceName, resp)
+	}
+
+	var order models.Order
+	if err := json.Unmarshal(resp.Body(), &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *orderService) ListOrders(ctx context.Context, userID uint) ([]models.Order, error) {
+	resp, err := s.doShared(ctx, "ListOrders", fmt.Sprint(userID), func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetQueryParam("user_id", fmt.Sprint(userID)).
+			Get("/orders")
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, newUpstreamError(OrderServiceName, resp)
+	}
+
+	var orders []models.Order
+	if err := json.Unmarshal(resp.Body(), &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (s *orderService) CancelOrder(ctx context.Context, id uint) (*models.Order, error) {
+	resp, err := s.do(ctx, "CancelOrder", func(r *resty.Request) (*resty.Response, error) {
+		return r.Post(fmt.Sprintf("/orders/%d/cancel", id))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, newUpstreamError(OrderServiceName, resp)
 	}
 
 	var order models.Order
@@ -1,7 +1,10 @@
 package services
 
 import (
+	"context"
+	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
 	"encoding/json"
 	"fmt"
 
@@ -9,24 +12,44 @@ import (
 )
 
 type paymentService struct {
-	baseURL string
-	client  *resty.Client
+	*upstream
 }
 
-func NewPaymentService(baseURL string, client *resty.Client) PaymentService {
-	return &paymentService{baseURL: baseURL, client: client}
+func NewPaymentService(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) PaymentService {
+	return &paymentService{upstream: newUpstream(PaymentServiceName, baseURL, client, cfg, breaker)}
 }
 
-func (s *paymentService) ProcessPayment(req models.CreatePaymentRequest) (*models.Payment, error) {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/payments")
+func (s *paymentService) ProcessPayment(ctx context.Context, req models.CreatePaymentRequest) (*models.Payment, error) {
+	resp, err := s.do(ctx, "ProcessPayment", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/payments")
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("payment service error: %s", resp.String())
+		return nil, newUpstreamError(PaymentServiceName, resp)
+	}
+
+	var payment models.Payment
+	if err := json.Unmarshal(resp.Body(), &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (s *paymentService) RefundPayment(ctx context.Context, id uint) (*models.Payment, error) {
+	resp, err := s.do(ctx, "RefundPayment", func(r *resty.Request) (*resty.Response, error) {
+		return r.Post(fmt.Sprintf("/payments/%d/refund", id))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, newUpstreamError(PaymentServiceName, resp)
 	}
 
 	var payment models.Payment
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/cache"
+	"ecommerce-go-api-gateway/pkg/logger"
+	"ecommerce-go-api-gateway/pkg/metrics"
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+
+	"go.uber.org/zap"
+)
+
+// Product cache keys are "products:<route>?<params>|<scope>", e.g.
+// "products:get_product?id=7|public".
+const productCachePrefix = "products:"
+
+// productCache holds cached product reads. It is shared by the product and
+// inventory services so that stock updates invalidate products too.
+type productCache struct {
+	store  cache.Store
+	routes map[string]config.CacheRouteConfig
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+
+	// generation is bumped by every invalidation. A read captures it before
+	// fetching and drops its result if it changed, so a fetch that started
+	// before a write cannot put the old product back.
+	genMu      sync.Mutex
+	generation uint64
+
+	now func() time.Time
+}
+
+func newProductCache(store cache.Store, cfg config.CacheConfig) *productCache {
+	return &productCache{store: store, routes: cfg.Routes, refreshing: make(map[string]bool), now: time.Now}
+}
+
+// cachedRead serves route from c while the entry is fresh. Past its TTL the
+// entry is still served, and refreshed in the background, for
+// stale_while_revalidate; after that it only stands in for a failed fetch
+// for stale_if_error. Fresh reads (see WithFreshRead) and routes without a
+// cache entry in the config always fetch.
+func cachedRead[T any](ctx context.Context, c *productCache, route string, params url.Values, fetch func(context.Context) (T, error)) (T, error) {
+	cfg, ok := c.routes[route]
+	if !ok {
+		return fetch(ctx)
+	}
+	key := cacheKey(ctx, route, params, cfg)
+	gen := c.currentGeneration()
+
+	var stale T
+	var entry cache.Entry
+	var found bool
+	if !isFreshRead(ctx) {
+		var err error
+		entry, found, err = c.store.Get(key)
+		if err != nil {
+			logger.Log.Warn("Cache read failed", zap.String("key", key), zap.Error(err))
+		}
+	}
+	if found && json.Unmarshal(entry.Value, &stale) != nil {
+		found = false
+	}
+	if found {
+		switch age := c.now().Sub(entry.StoredAt); {
+		case age < cfg.TTL:
+			metrics.CacheLookup(route, "hit")
+			return stale, nil
+		case age < cfg.TTL+cfg.StaleWhileRevalidate:
+			metrics.CacheLookup(route, "stale")
+			c.revalidate(key, func() {
+				gen := c.currentGeneration()
+				if v, err := fetch(context.WithoutCancel(ctx)); err == nil {
+					c.put(key, cfg, gen, v)
+				}
+			})
+			return stale, nil
+		}
+	}
+
+	v, err := fetch(ctx)
+	if err != nil {
+		if found && c.now().Sub(entry.StoredAt) < cfg.TTL+cfg.StaleIfError && servesStale(err) {
+			metrics.CacheLookup(route, "stale_if_error")
+			logger.Log.Warn("Serving stale cache entry", zap.String("key", key), zap.Error(err))
+			return stale, nil
+		}
+		return v, err
+	}
+	metrics.CacheLookup(route, "miss")
+	c.put(key, cfg, gen, v)
+	return v, nil
+}
+
+// cacheKey scopes the key to the caller when the route is per_user.
+func cacheKey(ctx context.Context, route string, params url.Values, cfg config.CacheRouteConfig) string {
+	scope := "public"
+	if cfg.PerUser {
+		scope = callerScope(ctx)
+	}
+	return productCachePrefix + route + "?" + params.Encode() + "|" + scope
+}
+
+// servesStale reports whether a stale entry may replace err. Rejections by
+// the product service (e.g. 404) and cancelled requests are passed on.
+func servesStale(err error) bool {
+	var upstreamErr *upstreamerr.Error
+	if errors.As(err, &upstreamErr) && upstreamErr.IsClientError() {
+		return false
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// revalidate runs refresh in the background unless one is already running
+// for key.
+func (c *productCache) revalidate(key string, refresh func()) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		refresh()
+	}()
+}
+
+func (c *productCache) currentGeneration() uint64 {
+	c.genMu.Lock()
+	defer c.genMu.Unlock()
+	return c.generation
+}
+
+// put keeps v for as long as any of the route's windows can serve it, unless
+// the cache was invalidated since gen was read.
+func (c *productCache) put(key string, cfg config.CacheRouteConfig, gen uint64, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	ttl := cfg.TTL + max(cfg.StaleWhileRevalidate, cfg.StaleIfError)
+
+	c.genMu.Lock()
+	defer c.genMu.Unlock()
+	if c.generation != gen {
+		return
+	}
+	if err := c.store.Set(key, cache.Entry{Value: body, StoredAt: c.now()}, ttl); err != nil {
+		logger.Log.Warn("Cache write failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (c *productCache) invalidate(prefixes ...string) {
+	c.genMu.Lock()
+	defer c.genMu.Unlock()
+	c.generation++
+	for _, prefix := range prefixes {
+		if err := c.store.DeletePrefix(prefix); err != nil {
+			logger.Log.Warn("Cache invalidation failed", zap.String("prefix", prefix), zap.Error(err))
+		}
+	}
+}
+
+func listProductsPrefix() string {
+	return productCachePrefix + config.CacheListProducts + "?"
+}
+
+func getProductPrefix(id uint) string {
+	return productCachePrefix + config.CacheGetProduct + "?" + productParams(id).Encode() + "|"
+}
+
+func productParams(id uint) url.Values {
+	return url.Values{"id": {strconv.FormatUint(uint64(id), 10)}}
+}
+
+// cachedProductService serves product reads from a productCache and drops
+// the entries a successful write changes.
+type cachedProductService struct {
+	ProductService
+	cache *productCache
+}
+
+func (s *cachedProductService) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
+	return cachedRead(ctx, s.cache, config.CacheGetProduct, productParams(id), func(ctx context.Context) (*models.Product, error) {
+		return s.ProductService.GetProduct(ctx, id)
+	})
+}
+
+func (s *cachedProductService) ListProducts(ctx context.Context, query models.ProductQuery) (*models.ProductPage, error) {
+	return cachedRead(ctx, s.cache, config.CacheListProducts, productQueryParams(query), func(ctx context.Context) (*models.ProductPage, error) {
+		return s.ProductService.ListProducts(ctx, query)
+	})
+}
+
+func (s *cachedProductService) CreateProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
+	product, err := s.ProductService.CreateProduct(ctx, req)
+	if err == nil {
+		s.cache.invalidate(listProductsPrefix())
+	}
+	return product, err
+}
+
+func (s *cachedProductService) UpdateProduct(ctx context.Context, id uint, req models.UpdateProductRequest) (*models.Product, error) {
+	product, err := s.ProductService.UpdateProduct(ctx, id, req)
+	if err == nil {
+		s.cache.invalidate(getProductPrefix(id), listProductsPrefix())
+	}
+	return product, err
+}
+
+func (s *cachedProductService) DeleteProduct(ctx context.Context, id uint) error {
+	err := s.ProductService.DeleteProduct(ctx, id)
+	if err == nil {
+		s.cache.invalidate(getProductPrefix(id), listProductsPrefix())
+	}
+	return err
+}
+
+// invalidatingInventoryService drops the cached product, and the lists it
+// appears in, when its stock changes.
+type invalidatingInventoryService struct {
+	InventoryService
+	cache *productCache
+}
+
+func (s *invalidatingInventoryService) UpdateStock(ctx context.Context, req models.UpdateInventoryRequest) error {
+	err := s.InventoryService.UpdateStock(ctx, req)
+	if err == nil {
+		s.cache.invalidate(getProductPrefix(req.ProductID), listProductsPrefix())
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/cache"
+	"ecommerce-go-api-gateway/pkg/upstreamerr"
+)
+
+// fakeProducts answers GetProduct with the product named after the number
+// of reads so far ("v1", "v2", ...), or with err. If arrived is set, a read
+// reports on it and waits for release before answering.
+type fakeProducts struct {
+	ProductService
+
+	mu      sync.Mutex
+	reads   int
+	err     error
+	arrived chan struct{}
+	release chan struct{}
+}
+
+func (f *fakeProducts) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
+	f.mu.Lock()
+	f.reads++
+	product := &models.Product{ID: id, Name: fmt.Sprintf("v%d", f.reads)}
+	err, arrived, release := f.err, f.arrived, f.release
+	f.mu.Unlock()
+
+	if arrived != nil {
+		arrived <- struct{}{}
+		<-release
+	}
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (f *fakeProducts) UpdateProduct(ctx context.Context, id uint, req models.UpdateProductRequest) (*models.Product, error) {
+	return &models.Product{ID: id}, nil
+}
+
+func (f *fakeProducts) readCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+var testCacheRoute = config.CacheRouteConfig{TTL: 10 * time.Second, StaleWhileRevalidate: 20 * time.Second, StaleIfError: 60 * time.Second}
+
+// newCachedProducts returns a product service cached with testCacheRoute,
+// whose cache clock reads from *now.
+func newCachedProducts(products *fakeProducts) (*cachedProductService, *time.Time) {
+	c := newProductCache(cache.NewMemoryStore(0), config.CacheConfig{Routes: map[string]config.CacheRouteConfig{config.CacheGetProduct: testCacheRoute}})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return &cachedProductService{ProductService: products, cache: c}, &now
+}
+
+// waitRevalidated waits for background refreshes to finish.
+func waitRevalidated(t *testing.T, c *productCache) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		n := len(c.refreshing)
+		c.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("background refresh did not finish")
+}
+
+func TestCachedRead(t *testing.T) {
+	unavailable := &upstreamerr.Error{Service: ProductServiceName, StatusCode: http.StatusServiceUnavailable}
+	notFound := &upstreamerr.Error{Service: ProductServiceName, StatusCode: http.StatusNotFound}
+
+	// read is one GetProduct at offset at from the start of the test clock,
+	// while the product service fails with err.
+	type read struct {
+		at        time.Duration
+		err       error
+		fresh     bool
+		want      string // product name, empty when the read fails
+		wantReads int    // upstream reads so far, background refreshes included
+	}
+	tests := []struct {
+		name  string
+		reads []read
+	}{
+		{
+			name: "fresh then stale then revalidated",
+			reads: []read{
+				{at: 0, want: "v1", wantReads: 1},
+				{at: 9 * time.Second, want: "v1", wantReads: 1},
+				{at: 15 * time.Second, want: "v1", wantReads: 2},
+				{at: 16 * time.Second, want: "v2", wantReads: 2},
+				{at: 24 * time.Second, want: "v2", wantReads: 2},
+			},
+		},
+		{
+			name: "failed revalidation keeps the entry",
+			reads: []read{
+				{at: 0, want: "v1", wantReads: 1},
+				{at: 15 * time.Second, err: unavailable, want: "v1", wantReads: 2},
+				{at: 16 * time.Second, want: "v1", wantReads: 3},
+				{at: 17 * time.Second, want: "v3", wantReads: 3},
+			},
+		},
+		{
+			name: "past stale_while_revalidate",
+			reads: []read{
+				{at: 0, want: "v1", wantReads: 1},
+				{at: 30 * time.Second, want: "v2", wantReads: 2},
+			},
+		},
+		{
+			name: "stale if error",
+			reads: []read{
+				{at: 0, want: "v1", wantReads: 1},
+				{at: 40 * time.Second, err: unavailable, want: "v1", wantReads: 2},
+				{at: 69 * time.Second, err: unavailable, want: "v1", wantReads: 3},
+				{at: 70 * time.Second, err: unavailable, wantReads: 4},
+			},
+		},
+		{
+			name: "client errors are not hidden",
+			reads: []read{
+				{at: 0, want: "v1", wantReads: 1},
+				{at: 40 * time.Second, err: notFound, wantReads: 2},
+			},
+		},
+		{
+			name: "errors are not cached",
+			reads: []read{
+				{at: 0, err: unavailable, wantReads: 1},
+				{at: time.Second, want: "v2", wantReads: 2},
+				{at: 2 * time.Second, want: "v2", wantReads: 2},
+			},
+		},
+		{
+			name: "fresh read skips the cache",
+			reads: []read{
+				{at: 0, want: "v1", wantReads: 1},
+				{at: time.Second, fresh: true, want: "v2", wantReads: 2},
+				{at: 2 * time.Second, want: "v2", wantReads: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products := &fakeProducts{}
+			s, now := newCachedProducts(products)
+			start := *now
+			for i, r := range tt.reads {
+				*now = start.Add(r.at)
+				products.mu.Lock()
+				products.err = r.err
+				products.mu.Unlock()
+
+				ctx := context.Background()
+				if r.fresh {
+					ctx = WithFreshRead(ctx)
+				}
+				product, err := s.GetProduct(ctx, 1)
+				waitRevalidated(t, s.cache)
+
+				switch {
+				case r.want == "" && err == nil:
+					t.Errorf("read %d at %v: got %s, want an error", i, r.at, product.Name)
+				case r.want != "" && (err != nil || product.Name != r.want):
+					t.Errorf("read %d at %v: got %v, %v, want %s", i, r.at, product, err, r.want)
+				}
+				if got := products.readCount(); got != r.wantReads {
+					t.Errorf("read %d at %v: %d upstream reads, want %d", i, r.at, got, r.wantReads)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedReadInvalidatedInFlight(t *testing.T) {
+	tests := []struct {
+		name string
+		at   time.Duration // when the read that races the update is made
+	}{
+		{name: "miss", at: 0},
+		{name: "revalidation", at: 15 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products := &fakeProducts{}
+			s, now := newCachedProducts(products)
+			start := *now
+			if tt.at > 0 {
+				s.GetProduct(context.Background(), 1)
+				*now = start.Add(tt.at)
+			}
+
+			products.arrived, products.release = make(chan struct{}), make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				s.GetProduct(context.Background(), 1)
+				close(done)
+			}()
+			<-products.arrived
+			if _, err := s.UpdateProduct(context.Background(), 1, models.UpdateProductRequest{}); err != nil {
+				t.Fatal(err)
+			}
+			products.mu.Lock()
+			products.arrived = nil
+			products.mu.Unlock()
+			close(products.release)
+			<-done
+			waitRevalidated(t, s.cache)
+
+			// The read that raced the update must not have been cached
+			reads := products.readCount()
+			product, err := s.GetProduct(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("v%d", reads+1); product.Name != want {
+				t.Errorf("got %s after the update, want a new read %s", product.Name, want)
+			}
+		})
+	}
+}
+
+func TestCachedReadEviction(t *testing.T) {
+	products := &fakeProducts{}
+	s, _ := newCachedProducts(products)
+	// Room for one entry only
+	body, _ := json.Marshal(&models.Product{ID: 1, Name: "v1"})
+	size := len(cacheKey(context.Background(), config.CacheGetProduct, productParams(1), testCacheRoute)) + len(body)
+	s.cache.store = cache.NewMemoryStore(int64(size * 3 / 2))
+
+	for i, tt := range []struct {
+		id        uint
+		wantReads int
+	}{
+		{id: 1, wantReads: 1},
+		{id: 1, wantReads: 1},
+		{id: 2, wantReads: 2},
+		{id: 2, wantReads: 2},
+		{id: 1, wantReads: 3},
+	} {
+		if _, err := s.GetProduct(context.Background(), tt.id); err != nil {
+			t.Fatal(err)
+		}
+		if got := products.readCount(); got != tt.wantReads {
+			t.Errorf("read %d of product %d: %d upstream reads, want %d", i, tt.id, got, tt.wantReads)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ecommerce-go-api-gateway/models"
+)
+
+// ErrInvalidCursor is returned for a listing cursor the gateway did not
+// issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// productQueryParams encodes q as the query string sent to the product
+// service. The encoding is canonical, so it also keys cached and
+// coalesced listings.
+func productQueryParams(q models.ProductQuery) url.Values {
+	params := url.Values{}
+	if q.Page > 0 {
+		params.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PageSize > 0 {
+		params.Set("page_size", strconv.Itoa(q.PageSize))
+	}
+	if q.Cursor != "" {
+		params.Set("cursor", q.Cursor)
+	}
+	if q.MinPrice != nil {
+		params.Set("min_price", strconv.FormatFloat(*q.MinPrice, 'f', -1, 64))
+	}
+	if q.MaxPrice != nil {
+		params.Set("max_price", strconv.FormatFloat(*q.MaxPrice, 'f', -1, 64))
+	}
+	if q.Search != "" {
+		params.Set("search", q.Search)
+	}
+	if q.InStock != nil {
+		params.Set("in_stock", strconv.FormatBool(*q.InStock))
+	}
+	if len(q.Sort) > 0 {
+		params.Set("sort", strings.Join(q.Sort, ","))
+	}
+	return params
+}
+
+// decodeProductPage reads a listing from the product service: a page, or
+// the whole catalog as an array from a product service that does not page
+// yet, in which case the gateway applies q itself.
+func decodeProductPage(body []byte, q models.ProductQuery) (*models.ProductPage, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		var products []models.Product
+		if err := json.Unmarshal(body, &products); err != nil {
+			return nil, err
+		}
+		return pageProducts(products, q)
+	}
+
+	var page models.ProductPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, err
+	}
+	if page.Products == nil {
+		page.Products = []models.Product{}
+	}
+	return &page, nil
+}
+
+// pageProducts filters, sorts and pages products by q. Its cursors encode
+// the offset of the next page; offsets past the listing are invalid, while
+// page numbers past it give an empty page.
+func pageProducts(products []models.Product, q models.ProductQuery) (*models.ProductPage, error) {
+	size := q.PageSize
+	if size <= 0 {
+		size = models.DefaultProductPageSize
+	}
+
+	search := strings.ToLower(q.Search)
+	matched := make([]models.Product, 0, len(products))
+	for _, p := range products {
+		switch {
+		case q.MinPrice != nil && p.Price < *q.MinPrice,
+			q.MaxPrice != nil && p.Price > *q.MaxPrice,
+			q.InStock != nil && *q.InStock != (p.Stock > 0),
+			search != "" && !strings.Contains(strings.ToLower(p.Name), search):
+			continue
+		}
+		matched = append(matched, p)
+	}
+	order := append(slices.Clone(q.Sort), "id")
+	slices.SortStableFunc(matched, func(a, b models.Product) int {
+		for _, field := range order {
+			desc := strings.HasPrefix(field, "-")
+			c := compareProducts(a, b, strings.TrimPrefix(field, "-"))
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	offset := 0
+	switch {
+	case q.Cursor != "":
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		if offset, err = strconv.Atoi(string(raw)); err != nil || offset < 0 || offset > len(matched) {
+			return nil, ErrInvalidCursor
+		}
+	case q.Page > 1:
+		// Compared before multiplying, so huge page numbers cannot overflow
+		offset = len(matched)
+		if q.Page-1 < (len(matched)+size-1)/size {
+			offset = (q.Page - 1) * size
+		}
+	}
+	end := offset + min(size, len(matched)-offset)
+
+	page := &models.ProductPage{
+		Products:   matched[offset:end],
+		Pagination: models.Pagination{Page: q.Page, PageSize: size, Total: len(matched)},
+	}
+	if end < len(matched) {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return page, nil
+}
+
+func compareProducts(a, b models.Product, field string) int {
+	switch field {
+	case "name":
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case "price":
+		return cmp.Compare(a.Price, b.Price)
+	case "stock":
+		return cmp.Compare(a.Stock, b.Stock)
+	default:
+		return cmp.Compare(a.ID, b.ID)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+
+	"ecommerce-go-api-gateway/models"
+)
+
+func TestPageProducts(t *testing.T) {
+	catalog := []models.Product{
+		{ID: 1, Name: "Banana", Price: 3, Stock: 0},
+		{ID: 2, Name: "apple", Price: 1, Stock: 5},
+		{ID: 3, Name: "Cherry", Price: 3, Stock: 2},
+		{ID: 4, Name: "Date", Price: 10, Stock: 1},
+		{ID: 5, Name: "Apricot", Price: 2, Stock: 0},
+	}
+	price := func(v float64) *float64 { return &v }
+	boolean := func(v bool) *bool { return &v }
+	cursor := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name       string
+		query      models.ProductQuery
+		wantIDs    []uint
+		wantTotal  int
+		wantCursor string
+		wantErr    error
+	}{
+		{name: "defaults", query: models.ProductQuery{}, wantIDs: []uint{1, 2, 3, 4, 5}, wantTotal: 5},
+		{name: "price range", query: models.ProductQuery{MinPrice: price(2), MaxPrice: price(3)}, wantIDs: []uint{1, 3, 5}, wantTotal: 3},
+		{name: "search ignores case", query: models.ProductQuery{Search: "AP"}, wantIDs: []uint{2, 5}, wantTotal: 2},
+		{name: "in stock", query: models.ProductQuery{InStock: boolean(true)}, wantIDs: []uint{2, 3, 4}, wantTotal: 3},
+		{name: "out of stock", query: models.ProductQuery{InStock: boolean(false)}, wantIDs: []uint{1, 5}, wantTotal: 2},
+		{name: "sort descending then ascending", query: models.ProductQuery{Sort: []string{"-price", "name"}}, wantIDs: []uint{4, 1, 3, 5, 2}, wantTotal: 5},
+		{name: "sort name ignores case", query: models.ProductQuery{Sort: []string{"name"}}, wantIDs: []uint{2, 5, 1, 3, 4}, wantTotal: 5},
+		{name: "first page", query: models.ProductQuery{Page: 1, PageSize: 2}, wantIDs: []uint{1, 2}, wantTotal: 5, wantCursor: cursor("2")},
+		{name: "last page", query: models.ProductQuery{Page: 3, PageSize: 2}, wantIDs: []uint{5}, wantTotal: 5},
+		{name: "page past the end", query: models.ProductQuery{Page: 4, PageSize: 2}, wantIDs: []uint{}, wantTotal: 5},
+		{name: "huge page", query: models.ProductQuery{Page: 1 << 62, PageSize: 20}, wantIDs: []uint{}, wantTotal: 5},
+		{name: "huge page size", query: models.ProductQuery{PageSize: 1<<63 - 1}, wantIDs: []uint{1, 2, 3, 4, 5}, wantTotal: 5},
+		{name: "cursor", query: models.ProductQuery{Cursor: cursor("2"), PageSize: 2}, wantIDs: []uint{3, 4}, wantTotal: 5, wantCursor: cursor("4")},
+		{name: "cursor at the end", query: models.ProductQuery{Cursor: cursor("5"), PageSize: 2}, wantIDs: []uint{}, wantTotal: 5},
+		{name: "cursor past the end", query: models.ProductQuery{Cursor: cursor("6")}, wantErr: ErrInvalidCursor},
+		{name: "huge cursor", query: models.ProductQuery{Cursor: cursor("9223372036854775800")}, wantErr: ErrInvalidCursor},
+		{name: "negative cursor", query: models.ProductQuery{Cursor: cursor("-1")}, wantErr: ErrInvalidCursor},
+		{name: "malformed cursor", query: models.ProductQuery{Cursor: "zz!"}, wantErr: ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := pageProducts(slices.Clone(catalog), tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			ids := []uint{}
+			for _, p := range page.Products {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", page.Total, tt.wantTotal)
+			}
+			if page.NextCursor != tt.wantCursor {
+				t.Errorf("next cursor = %q, want %q", page.NextCursor, tt.wantCursor)
+			}
+		})
+	}
+}
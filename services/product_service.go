@@ -1,7 +1,10 @@
 package services
 
 import (
+	"context"
+	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
 	"encoding/json"
 	"fmt"
 
@@ -9,23 +12,23 @@ import (
 )
 
 type productService struct {
-	baseURL string
-	client  *resty.Client
+	*upstream
 }
 
-func NewProductService(baseURL string, client *resty.Client) ProductService {
-	return &productService{baseURL: baseURL, client: client}
+func NewProductService(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) ProductService {
+	return &productService{upstream: newUpstream(ProductServiceName, baseURL, client, cfg, breaker)}
 }
 
-func (s *productService) GetProduct(id uint) (*models.Product, error) {
-	resp, err := s.client.R().
-		Get(fmt.Sprintf("%s/products/%d", s.baseURL, id))
+func (s *productService) GetProduct(ctx context.Context, id uint) (*models.Product, error) {
+	resp, err := s.doShared(ctx, "GetProduct", fmt.Sprint(id), func(r *resty.Request) (*resty.Response, error) {
+		return r.Get(fmt.Sprintf("/products/%d", id))
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("product service error: %s", resp.String())
+		return nil, newUpstreamError(ProductServiceName, resp)
 	}
 
 	var product models.Product
@@ -35,34 +38,57 @@ func (s *productService) GetProduct(id uint) (*models.Product, error) {
 	return &product, nil
 }
 
-func (s *productService) ListProducts() ([]models.Product, error) {
-	resp, err := s.client.R().
-		Get(s.baseURL + "/products")
+func (s *productService) ListProducts(ctx context.Context, query models.ProductQuery) (*models.ProductPage, error) {
+	params := productQueryParams(query)
+	resp, err := s.doShared(ctx, "ListProducts", params.Encode(), func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetQueryParamsFromValues(params).
+			Get("/products")
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("product service error: %s", resp.String())
+		return nil, newUpstreamError(ProductServiceName, resp)
 	}
 
-	var products []models.Product
-	if err := json.Unmarshal(resp.Body(), &products); err != nil {
+	return decodeProductPage(resp.Body(), query)
+}
+
+func (s *productService) CreateProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
+	resp, err := s.do(ctx, "CreateProduct", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/products")
+	})
+
+	if err != nil {
 		return nil, err
 	}
-	return products, nil
+	if resp.IsError() {
+		return nil, newUpstreamError(ProductServiceName, resp)
+	}
+
+	var product models.Product
+	if err := json.Unmarshal(resp.Body(), &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
 }
 
-func (s *productService) CreateProduct(req models.CreateProductRequest) (*models.Product, error) {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/products")
+func (s *productService) UpdateProduct(ctx context.Context, id uint, req models.UpdateProductRequest) (*models.Product, error) {
+	resp, err := s.do(ctx, "UpdateProduct", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Put(fmt.Sprintf("/products/%d", id))
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("product service error: %s", resp.String())
+		return nil, newUpstreamError(ProductServiceName, resp)
 	}
 
 	var product models.Product
@@ -71,3 +97,17 @@ func (s *productService) CreateProduct(req models.CreateProductRequest) (*models
 	}
 	return &product, nil
 }
+
+func (s *productService) DeleteProduct(ctx context.Context, id uint) error {
+	resp, err := s.do(ctx, "DeleteProduct", func(r *resty.Request) (*resty.Response, error) {
+		return r.Delete(fmt.Sprintf("/products/%d", id))
+	})
+
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return newUpstreamError(ProductServiceName, resp)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ProxyRequest is a request forwarded to Service as it is. Path is relative
+// to the service's base URL and Operation names the call in metrics,
+// traces and the access log. A positive Timeout replaces the service's.
+type ProxyRequest struct {
+	Service   string
+	Operation string
+	Method    string
+	Path      string
+	RawQuery  string
+	Header    http.Header
+	Body      []byte
+	Timeout   time.Duration
+}
+
+// ProxyResponse is the upstream's answer to a ProxyRequest.
+type ProxyResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type proxyService struct {
+	upstreams map[string]*upstream
+}
+
+func newProxyService(upstreams map[string]*upstream) ProxyService {
+	return &proxyService{upstreams: upstreams}
+}
+
+// Forward sends req upstream with the service's client, so retries, the
+// circuit breaker and tracing apply as for any other call. 4xx responses
+// are returned as they are; 5xx responses become an *upstreamerr.Error.
+func (s *proxyService) Forward(ctx context.Context, req ProxyRequest) (*ProxyResponse, error) {
+	u, ok := s.upstreams[req.Service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q", req.Service)
+	}
+
+	resp, err := u.doWithTimeout(ctx, req.Operation, req.Timeout, func(r *resty.Request) (*resty.Response, error) {
+		for k, v := range req.Header {
+			// Keep the request ID, Idempotency-Key and traceparent set for the call
+			if r.Header.Get(k) == "" {
+				r.Header[k] = v
+			}
+		}
+		if len(req.Body) > 0 {
+			r.SetBody(req.Body)
+		}
+		return r.
+			SetQueryString(req.RawQuery).
+			Execute(req.Method, req.Path)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() >= 500 {
+		return nil, newUpstreamError(req.Service, resp)
+	}
+
+	return &ProxyResponse{
+		StatusCode: resp.StatusCode(),
+		Header:     resp.Header(),
+		Body:       resp.Body(),
+	}, nil
+}
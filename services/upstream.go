@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ecommerce-go-api-gateway/config"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
+	"ecommerce-go-api-gateway/pkg/metrics"
+	"ecommerce-go-api-gateway/pkg/requestid"
+	"ecommerce-go-api-gateway/pkg/tracing"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Service names, matching the keys under services in config.yaml.
+const (
+	UserServiceName         = "user_service"
+	ProductServiceName      = "product_service"
+	OrderServiceName        = "order_service"
+	PaymentServiceName      = "payment_service"
+	InventoryServiceName    = "inventory_service"
+	NotificationServiceName = "notification_service"
+)
+
+// upstream is the plumbing shared by every service client. Its connection
+// settings are swapped as a whole on config reload, so a call always uses one
+// consistent client, timeout and breaker.
+type upstream struct {
+	name    string
+	state   atomic.Pointer[upstreamState]
+	flights flightGroup
+
+	// sharedTimeout bounds a shared call when the service sets no timeout,
+	// as no caller can cancel it.
+	sharedTimeout time.Duration
+}
+
+// defaultSharedTimeout is the sharedTimeout of every upstream.
+const defaultSharedTimeout = 30 * time.Second
+
+type upstreamState struct {
+	client  *resty.Client
+	timeout time.Duration
+	breaker *circuitbreaker.Breaker
+}
+
+// newUpstream sets client's base URL, so calls use paths relative to it.
+func newUpstream(name, baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) *upstream {
+	u := &upstream{name: name, sharedTimeout: defaultSharedTimeout}
+	u.configure(baseURL, client, cfg, breaker)
+	return u
+}
+
+// configure replaces the upstream's connection settings. Calls already in
+// flight finish with the old ones.
+func (u *upstream) configure(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) {
+	client.SetBaseURL(baseURL)
+	u.state.Store(&upstreamState{client: client, timeout: cfg.Timeout, breaker: breaker})
+}
+
+// do runs one logical call (retries included) against the upstream. The call
+// is bound to ctx, capped by the service's timeout and guarded by its
+// circuit breaker; an open breaker fails fast with *circuitbreaker.OpenError.
+// op names the call in metrics, traces and the access log, e.g.
+// "ListProducts" is reported as product.ListProducts.
+func (u *upstream) do(ctx context.Context, op string, call func(r *resty.Request) (*resty.Response, error)) (*resty.Response, error) {
+	return u.doWithTimeout(ctx, op, 0, call)
+}
+
+// doShared is do for reads: identical calls, made for the same caller with
+// the same op and key (e.g. the ID read), that are in flight at once share
+// one upstream request and its response. A caller that gives up does not
+// cancel the request for the others; it still ends with the service's
+// timeout, or sharedTimeout if the service has none. Fresh reads are always
+// sent on their own.
+//
+// The shared request is made with the context of the caller that started
+// it, so it carries that caller's request ID and trace and is recorded in
+// its upstream calls; a call nobody joins is thus sent and observed like one
+// made with do. The caller's idempotency key is dropped, since it belongs to
+// that caller's write. Callers that join get a span of their own in their
+// trace and record the call, marked Shared, with the time they waited.
+func (u *upstream) doShared(ctx context.Context, op, key string, call func(r *resty.Request) (*resty.Response, error)) (*resty.Response, error) {
+	if isFreshRead(ctx) {
+		return u.do(ctx, op, call)
+	}
+	shared := WithIdempotencyKey(context.WithoutCancel(ctx), "")
+	start := time.Now()
+	resp, joined, err := u.flights.do(ctx, op+"?"+key+"|"+callerScope(ctx), func() (*resty.Response, error) {
+		timeout := u.state.Load().timeout
+		if timeout <= 0 {
+			timeout = u.sharedTimeout
+		}
+		return u.doWithTimeout(shared, op, timeout, call)
+	})
+	if joined {
+		u.joined(ctx, op, start, resp, err)
+	}
+	return resp, err
+}
+
+// joined reports a call that was served by another caller's request.
+func (u *upstream) joined(ctx context.Context, op string, start time.Time, resp *resty.Response, err error) {
+	operation := u.operation(op)
+	metrics.UpstreamCoalesced(u.name, operation)
+
+	_, span := tracing.Tracer().Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attribute.String("peer.service", u.name), attribute.Bool("gateway.shared", true)))
+	endSpan(span, resp, err, 0)
+	span.End()
+
+	record := UpstreamCall{Operation: operation, Duration: time.Since(start), Shared: true}
+	if err == nil {
+		record.Status = resp.StatusCode()
+	}
+	recordUpstreamCall(ctx, record)
+}
+
+// doWithTimeout is do with timeout replacing the service's timeout when it
+// is positive.
+func (u *upstream) doWithTimeout(ctx context.Context, op string, timeout time.Duration, call func(r *resty.Request) (*resty.Response, error)) (*resty.Response, error) {
+	operation := u.operation(op)
+	state := u.state.Load()
+	if err := state.breaker.Allow(); err != nil {
+		metrics.BreakerRejected(u.name, operation)
+		return nil, err
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("peer.service", u.name)))
+	defer span.End()
+
+	if timeout <= 0 {
+		timeout = state.timeout
+	}
+	r, cancel := state.request(ctx, timeout)
+	defer cancel()
+
+	done := metrics.UpstreamStarted(u.name, operation)
+	start := time.Now()
+	resp, err := call(r)
+	elapsed := time.Since(start)
+	state.breaker.Done(isFailure(ctx, resp, err), elapsed)
+
+	retries := max(r.Attempt-1, 0)
+	done(callOutcome(resp, err), retries)
+	endSpan(span, resp, err, retries)
+
+	record := UpstreamCall{Operation: operation, Duration: elapsed, Retries: retries}
+	if err == nil {
+		record.Status = resp.StatusCode()
+	}
+	recordUpstreamCall(ctx, record)
+	return resp, err
+}
+
+// operation qualifies op with the service, e.g. product.ListProducts.
+func (u *upstream) operation(op string) string {
+	return strings.TrimSuffix(u.name, "_service") + "." + op
+}
+
+func endSpan(span trace.Span, resp *resty.Response, err error, retries int) {
+	if retries > 0 {
+		span.SetAttributes(attribute.Int("http.request.resend_count", retries))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+	if resp.StatusCode() >= 500 {
+		span.SetStatus(codes.Error, "")
+	}
+}
+
+// request starts a resty request bound to ctx and capped by timeout. The
+// returned cancel func must be called once the response is read.
+func (s *upstreamState) request(ctx context.Context, timeout time.Duration) (*resty.Request, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	r := s.client.R().SetContext(ctx)
+	if key := IdempotencyKeyFromContext(ctx); key != "" {
+		r.SetHeader(IdempotencyKeyHeader, key)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		r.SetHeader(requestid.Header, id)
+	}
+	if id, ok := UserIDFromContext(ctx); ok {
+		r.SetHeader(UserIDHeader, strconv.FormatUint(uint64(id), 10))
+	}
+	// Send traceparent so the upstream continues the current trace
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	return r, cancel
+}
+
+// callOutcome labels a finished call by its status class, or "error" when
+// no response was received.
+func callOutcome(resp *resty.Response, err error) string {
+	if err != nil || resp == nil || resp.RawResponse == nil {
+		return "error"
+	}
+	return metrics.StatusClass(resp.StatusCode())
+}
+
+// isFailure reports whether a call should count against the breaker: transport
+// errors and 5xx responses do, client cancellations and 4xx responses do not.
+func isFailure(ctx context.Context, resp *resty.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	return resp.StatusCode() >= 500
+}
@@ -1,7 +1,10 @@
 package services
 
 import (
+	"context"
+	"ecommerce-go-api-gateway/config"
 	"ecommerce-go-api-gateway/models"
+	"ecommerce-go-api-gateway/pkg/circuitbreaker"
 	"encoding/json"
 	"fmt"
 
@@ -9,24 +12,25 @@ import (
 )
 
 type userService struct {
-	baseURL string
-	client  *resty.Client
+	*upstream
 }
 
-func NewUserService(baseURL string, client *resty.Client) UserService {
-	return &userService{baseURL: baseURL, client: client}
+func NewUserService(baseURL string, client *resty.Client, cfg config.ClientConfig, breaker *circuitbreaker.Breaker) UserService {
+	return &userService{upstream: newUpstream(UserServiceName, baseURL, client, cfg, breaker)}
 }
 
-func (s *userService) Login(req models.LoginRequest) (*models.LoginResponse, error) {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/login")
+func (s *userService) Login(ctx context.Context, req models.LoginRequest) (*models.LoginResponse, error) {
+	resp, err := s.do(ctx, "Login", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/login")
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("user service error: %s", resp.String())
+		return nil, newUpstreamError(UserServiceName, resp)
 	}
 
 	var loginResp models.LoginResponse
@@ -36,16 +40,18 @@ func (s *userService) Login(req models.LoginRequest) (*models.LoginResponse, err
 	return &loginResp, nil
 }
 
-func (s *userService) Register(req models.CreateUserRequest) (*models.User, error) {
-	resp, err := s.client.R().
-		SetBody(req).
-		Post(s.baseURL + "/register")
+func (s *userService) Register(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	resp, err := s.do(ctx, "Register", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Post("/register")
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("user service error: %s", resp.String())
+		return nil, newUpstreamError(UserServiceName, resp)
 	}
 
 	var user models.User
@@ -55,15 +61,16 @@ func (s *userService) Register(req models.CreateUserRequest) (*models.User, erro
 	return &user, nil
 }
 
-func (s *userService) GetUser(id uint) (*models.User, error) {
-	resp, err := s.client.R().
-		Get(fmt.Sprintf("%s/users/%d", s.baseURL, id))
+func (s *userService) GetUser(ctx context.Context, id uint) (*models.User, error) {
+	resp, err := s.doShared(ctx, "GetUser", fmt.Sprint(id), func(r *resty.Request) (*resty.Response, error) {
+		return r.Get(fmt.Sprintf("/users/%d", id))
+	})
 
 	if err != nil {
 		return nil, err
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("user service error: %s", resp.String())
+		return nil, newUpstreamError(UserServiceName, resp)
 	}
 
 	var user models.User
@@ -72,3 +79,38 @@ func (s *userService) GetUser(id uint) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+func (s *userService) UpdateUser(ctx context.Context, id uint, req models.UpdateUserRequest) (*models.User, error) {
+	resp, err := s.do(ctx, "UpdateUser", func(r *resty.Request) (*resty.Response, error) {
+		return r.
+			SetBody(req).
+			Put(fmt.Sprintf("/users/%d", id))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, newUpstreamError(UserServiceName, resp)
+	}
+
+	var user models.User
+	if err := json.Unmarshal(resp.Body(), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id uint) error {
+	resp, err := s.do(ctx, "DeleteUser", func(r *resty.Request) (*resty.Response, error) {
+		return r.Delete(fmt.Sprintf("/users/%d", id))
+	})
+
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return newUpstreamError(UserServiceName, resp)
+	}
+	return nil
+}